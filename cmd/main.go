@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"os"
 
 	"github.com/kubesphere/volume-initializer/pkg/webhook"
 	"k8s.io/klog/v2"
@@ -9,9 +10,13 @@ import (
 
 func main() {
 	rootCmd := webhook.CmdWebhook
+	rootCmd.AddCommand(webhook.CmdRender)
+	rootCmd.AddCommand(webhook.CmdExplain)
 
 	loggingFlags := &flag.FlagSet{}
 	klog.InitFlags(loggingFlags)
 	rootCmd.PersistentFlags().AddGoFlagSet(loggingFlags)
-	rootCmd.Execute()
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
 }
@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	"fmt"
 	"slices"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -23,8 +24,13 @@ type GenericSelector struct {
 }
 
 func (s *GenericSelector) Match(obj metav1.Object) bool {
+	return s.Explain(obj) == ""
+}
+
+// Explain returns why obj doesn't match the selector, an empty string is returned if it matches.
+func (s *GenericSelector) Explain(obj metav1.Object) string {
 	if obj == nil {
-		return false
+		return "object not found"
 	}
 
 	for _, req := range s.FieldSelector {
@@ -52,7 +58,7 @@ func (s *GenericSelector) Match(obj metav1.Object) bool {
 		}
 
 		if !match {
-			return false
+			return fmt.Sprintf("fieldSelector %s %s %v doesn't match %q", req.Key, req.Operator, req.Values, val)
 		}
 	}
 
@@ -63,13 +69,16 @@ func (s *GenericSelector) Match(obj metav1.Object) bool {
 		selector, err := metav1.LabelSelectorAsSelector(&labelSelector)
 		if err != nil {
 			klog.ErrorS(err, "LabelSelectorAsSelector", "labelSelector", labelSelector)
-			return false
+			return fmt.Sprintf("invalid labelSelector: %v", err)
 		}
-		match := selector.Matches(labels.Set(obj.GetLabels()))
-		if !match {
-			return false
+		objLabels := labels.Set(obj.GetLabels())
+		requirements, _ := selector.Requirements()
+		for _, req := range requirements {
+			if !req.Matches(objLabels) {
+				return fmt.Sprintf("labelSelector %q doesn't match labels %v", req.String(), objLabels)
+			}
 		}
 	}
 
-	return true
+	return ""
 }
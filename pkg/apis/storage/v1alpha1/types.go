@@ -25,6 +25,14 @@ import (
 // +k8s:openapi-gen=true
 // +genclient:nonNamespaced
 // +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Enabled",type=boolean,JSONPath=`.spec.enabled`
+// +kubebuilder:printcolumn:name="Mode",type=string,JSONPath=`.spec.mode`
+// +kubebuilder:printcolumn:name="Valid",type=string,JSONPath=`.status.conditions[?(@.type=="Valid")].status`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Injected",type=integer,JSONPath=`.status.injectedPods`
+// +kubebuilder:printcolumn:name="Last Injection",type=date,JSONPath=`.status.lastInjectionTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 type Initializer struct {
@@ -32,7 +40,7 @@ type Initializer struct {
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	Spec   InitializerSpec   `json:"spec"`
-	Status InitializerStatus `json:"status"`
+	Status InitializerStatus `json:"status,omitempty"`
 }
 
 type InitializerSpec struct {
@@ -40,8 +48,58 @@ type InitializerSpec struct {
 	InitContainers  []corev1.Container `json:"initContainers,omitempty"`
 	PVCMatchers     []PVCMatcher       `json:"pvcMatchers,omitempty"`
 	PVCInitializers []PVCInitializer   `json:"pvcInitializers,omitempty"`
+
+	// MatchPolicy is the default MatchPolicy of the PVCInitializers, default is "First".
+	// +kubebuilder:validation:Enum=First;All
+	MatchPolicy MatchPolicy `json:"matchPolicy,omitempty"`
+
+	// Priority is the default priority of the PVCInitializers, default is 0.
+	// PVCInitializers with higher priority are evaluated first.
+	Priority int32 `json:"priority,omitempty"`
+
+	// Mode decides whether the init containers are injected, default is "Enforce".
+	// +kubebuilder:validation:Enum=Enforce;Audit
+	Mode InitializerMode `json:"mode,omitempty"`
+
+	// FailurePolicy is the default FailurePolicy of the PVCInitializers, default is "Fail".
+	// +kubebuilder:validation:Enum=Fail;Ignore
+	FailurePolicy FailurePolicy `json:"failurePolicy,omitempty"`
 }
 
+// InitializerMode decides whether the init containers of an Initializer are injected into the pods it matches.
+type InitializerMode string
+
+const (
+	// InitializerModeEnforce injects the init containers.
+	InitializerModeEnforce InitializerMode = "Enforce"
+	// InitializerModeAudit evaluates the PVCInitializers as usual, but only reports what would have been injected,
+	// without injecting anything nor stopping the evaluation of the following PVCInitializers.
+	InitializerModeAudit InitializerMode = "Audit"
+)
+
+// FailurePolicy decides what happens to a pod when the objects a PVCInitializer matches against can't be read,
+// e.g. the StorageClass, Namespace or Workspace of a volume.
+type FailurePolicy string
+
+const (
+	// FailurePolicyFail denies the pod.
+	FailurePolicyFail FailurePolicy = "Fail"
+	// FailurePolicyIgnore skips the PVCInitializer for the volume with a warning, and goes on with the following ones.
+	FailurePolicyIgnore FailurePolicy = "Ignore"
+)
+
+// MatchPolicy decides whether the evaluation of PVCInitializers goes on after a PVCInitializer matches a volume.
+type MatchPolicy string
+
+const (
+	// MatchPolicyFirst stops the evaluation once the PVCInitializer matches,
+	// so no more init containers are injected for the volume.
+	MatchPolicyFirst MatchPolicy = "First"
+	// MatchPolicyAll goes on evaluating the following PVCInitializers, in this and the following Initializers,
+	// so that an ordered chain of init containers can be injected for the volume.
+	MatchPolicyAll MatchPolicy = "All"
+)
+
 type PVCInitializer struct {
 	// PVCMatcherName represents the name of PVCMatcher
 	PVCMatcherName string `json:"pvcMatcherName,omitempty"`
@@ -51,13 +109,76 @@ type PVCInitializer struct {
 
 	// MountPathRoot represents the root path of the mount point in the init container, default is "/".
 	MountPathRoot string `json:"mountPathRoot,omitempty"`
+
+	// DevicePathRoot represents the root path of the device in the init container for block volumes, default is "/dev".
+	DevicePathRoot string `json:"devicePathRoot,omitempty"`
+
+	// MatchPolicy overrides the MatchPolicy of the Initializer for this PVCInitializer.
+	// +kubebuilder:validation:Enum=First;All
+	MatchPolicy MatchPolicy `json:"matchPolicy,omitempty"`
+
+	// FailurePolicy overrides the FailurePolicy of the Initializer for this PVCInitializer.
+	// +kubebuilder:validation:Enum=Fail;Ignore
+	FailurePolicy FailurePolicy `json:"failurePolicy,omitempty"`
+
+	// Priority overrides the Priority of the Initializer for this PVCInitializer.
+	Priority *int32 `json:"priority,omitempty"`
+
+	// Position is where the init container is inserted among the pod's own init containers,
+	// default is to prepend it to them.
+	Position *InitContainerPosition `json:"position,omitempty"`
+}
+
+// InitContainerPositionType is the type of InitContainerPosition.
+type InitContainerPositionType string
+
+const (
+	// PositionPrepend inserts the init container before the pod's own init containers.
+	PositionPrepend InitContainerPositionType = "Prepend"
+	// PositionAppend inserts the init container after the pod's own init containers.
+	PositionAppend InitContainerPositionType = "Append"
+	// PositionBefore inserts the init container before the pod's init container named ContainerName.
+	PositionBefore InitContainerPositionType = "Before"
+	// PositionAfter inserts the init container after the pod's init container named ContainerName.
+	PositionAfter InitContainerPositionType = "After"
+)
+
+// InitContainerPosition is where an injected init container is inserted among the pod's own init containers.
+// If the pod has no init container named ContainerName, the init container is prepended.
+type InitContainerPosition struct {
+	// Type is the type of the position
+	// +kubebuilder:validation:Enum=Prepend;Append;Before;After
+	Type InitContainerPositionType `json:"type"`
+
+	// ContainerName is the name of the pod's init container, required when Type is "Before" or "After"
+	ContainerName string `json:"containerName,omitempty"`
 }
 
+// VolumeType is the type of the pod volume a PVC comes from.
+// +kubebuilder:validation:Enum=PersistentVolumeClaim;Ephemeral
+type VolumeType string
+
+const (
+	// VolumeTypePersistentVolumeClaim is a persistentVolumeClaim volume, which references an existing PVC.
+	VolumeTypePersistentVolumeClaim VolumeType = "PersistentVolumeClaim"
+	// VolumeTypeEphemeral is a generic ephemeral volume, whose PVC is created from the volumeClaimTemplate
+	// along with the pod and named <pod>-<volume>.
+	VolumeTypeEphemeral VolumeType = "Ephemeral"
+)
+
 // PVCMatcher is used to filter PVCs. If no selector is specified, it will match any PVC.
 type PVCMatcher struct {
 	// Name is the matcher name
 	Name string `json:"name,omitempty"`
 
+	// VolumeTypes matches the type of the pod volume the PVC comes from, default is to match any type.
+	VolumeTypes []VolumeType `json:"volumeTypes,omitempty"`
+
+	// VolumeModes matches the volumeMode of the PVC, default is to match any mode.
+	// A PVC without volumeMode is in "Filesystem" mode.
+	// +kubebuilder:validation:items:Enum=Filesystem;Block
+	VolumeModes []corev1.PersistentVolumeMode `json:"volumeModes,omitempty"`
+
 	// PVC matches the PVC itself
 	PVC *GenericSelector `json:"pvc,omitempty"`
 
@@ -74,7 +195,44 @@ type PVCMatcher struct {
 	Workspace *GenericSelector `json:"workspace,omitempty"`
 }
 
+const (
+	// ConditionValid indicates whether the spec is valid and every reference in spec.pvcInitializers can be resolved.
+	ConditionValid = "Valid"
+	// ConditionReady indicates whether the Initializer is enabled, valid and taking part in pod admission.
+	ConditionReady = "Ready"
+)
+
 type InitializerStatus struct {
+	// ObservedGeneration is the most recent generation observed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions represent the latest available observations of the Initializer's state.
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// DanglingReferences lists the references in spec.pvcInitializers that can't be resolved.
+	DanglingReferences []DanglingReference `json:"danglingReferences,omitempty"`
+
+	// InjectedPods is the number of existing pods the init containers of this Initializer have been injected into,
+	// counted from their storage.kubesphere.io/initialized-volumes annotation. Deleted pods are not counted.
+	InjectedPods int64 `json:"injectedPods,omitempty"`
+
+	// LastInjectionTime is the last time the init containers of this Initializer were injected into a pod,
+	// i.e. the creation time of the newest pod counted in InjectedPods.
+	LastInjectionTime *metav1.Time `json:"lastInjectionTime,omitempty"`
+}
+
+// DanglingReference is a reference in spec.pvcInitializers that points at a non-existent PVCMatcher or init container.
+type DanglingReference struct {
+	// PVCInitializerIndex is the index of the PVCInitializer in spec.pvcInitializers
+	PVCInitializerIndex int `json:"pvcInitializerIndex"`
+
+	// Field is the referencing field, either "pvcMatcherName" or "initContainerName"
+	Field string `json:"field"`
+
+	// Name is the name that can't be resolved
+	Name string `json:"name"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
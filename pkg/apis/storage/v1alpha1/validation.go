@@ -0,0 +1,215 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	FieldPVCMatcherName    = "pvcMatcherName"
+	FieldInitContainerName = "initContainerName"
+)
+
+// FindDanglingReferences returns the references in spec.pvcInitializers that point at
+// a PVCMatcher or an init container which is not defined in the spec.
+func FindDanglingReferences(spec *InitializerSpec) []DanglingReference {
+	matcherNames := make(map[string]bool, len(spec.PVCMatchers))
+	for _, m := range spec.PVCMatchers {
+		matcherNames[m.Name] = true
+	}
+	containerNames := make(map[string]bool, len(spec.InitContainers))
+	for _, c := range spec.InitContainers {
+		containerNames[c.Name] = true
+	}
+
+	var refs []DanglingReference
+	for i, pvcInitializer := range spec.PVCInitializers {
+		if !matcherNames[pvcInitializer.PVCMatcherName] {
+			refs = append(refs, DanglingReference{
+				PVCInitializerIndex: i,
+				Field:               FieldPVCMatcherName,
+				Name:                pvcInitializer.PVCMatcherName,
+			})
+		}
+		if !containerNames[pvcInitializer.InitContainerName] {
+			refs = append(refs, DanglingReference{
+				PVCInitializerIndex: i,
+				Field:               FieldInitContainerName,
+				Name:                pvcInitializer.InitContainerName,
+			})
+		}
+	}
+	return refs
+}
+
+// ValidateInitializer validates the spec of an Initializer: names must be unique, references
+// in pvcInitializers must be resolvable and selectors must only use supported keys and operators.
+func ValidateInitializer(initializer *Initializer) field.ErrorList {
+	return ValidateInitializerSpec(&initializer.Spec, field.NewPath("spec"))
+}
+
+func ValidateInitializerSpec(spec *InitializerSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	containerNames := sets.New[string]()
+	for i, c := range spec.InitContainers {
+		idxPath := fldPath.Child("initContainers").Index(i).Child("name")
+		if c.Name == "" {
+			allErrs = append(allErrs, field.Required(idxPath, ""))
+			continue
+		}
+		if containerNames.Has(c.Name) {
+			allErrs = append(allErrs, field.Duplicate(idxPath, c.Name))
+		}
+		containerNames.Insert(c.Name)
+	}
+
+	matcherNames := sets.New[string]()
+	for i := range spec.PVCMatchers {
+		allErrs = append(allErrs, validatePVCMatcher(&spec.PVCMatchers[i], matcherNames, fldPath.Child("pvcMatchers").Index(i))...)
+		matcherNames.Insert(spec.PVCMatchers[i].Name)
+	}
+
+	allErrs = append(allErrs, validateMatchPolicy(spec.MatchPolicy, fldPath.Child("matchPolicy"))...)
+	allErrs = append(allErrs, validateMode(spec.Mode, fldPath.Child("mode"))...)
+	allErrs = append(allErrs, validateFailurePolicy(spec.FailurePolicy, fldPath.Child("failurePolicy"))...)
+	for i, pvcInitializer := range spec.PVCInitializers {
+		idxPath := fldPath.Child("pvcInitializers").Index(i)
+		allErrs = append(allErrs, validateMatchPolicy(pvcInitializer.MatchPolicy, idxPath.Child("matchPolicy"))...)
+		allErrs = append(allErrs, validateFailurePolicy(pvcInitializer.FailurePolicy, idxPath.Child("failurePolicy"))...)
+		allErrs = append(allErrs, validatePosition(pvcInitializer.Position, idxPath.Child("position"))...)
+	}
+
+	for _, ref := range FindDanglingReferences(spec) {
+		refPath := fldPath.Child("pvcInitializers").Index(ref.PVCInitializerIndex).Child(ref.Field)
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(refPath, ""))
+			continue
+		}
+		allErrs = append(allErrs, field.NotFound(refPath, ref.Name))
+	}
+
+	return allErrs
+}
+
+func validatePVCMatcher(m *PVCMatcher, matcherNames sets.Set[string], fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if m.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("name"), ""))
+	} else if matcherNames.Has(m.Name) {
+		allErrs = append(allErrs, field.Duplicate(fldPath.Child("name"), m.Name))
+	}
+
+	for i, t := range m.VolumeTypes {
+		if t != VolumeTypePersistentVolumeClaim && t != VolumeTypeEphemeral {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("volumeTypes").Index(i), t, supportedVolumeTypes))
+		}
+	}
+
+	for i, mode := range m.VolumeModes {
+		if mode != corev1.PersistentVolumeFilesystem && mode != corev1.PersistentVolumeBlock {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("volumeModes").Index(i), mode, supportedVolumeModes))
+		}
+	}
+
+	allErrs = append(allErrs, validateGenericSelector(m.PVC, fldPath.Child("pvc"))...)
+	allErrs = append(allErrs, validateGenericSelector(m.Pod, fldPath.Child("pod"))...)
+	allErrs = append(allErrs, validateGenericSelector(m.StorageClass, fldPath.Child("storageClass"))...)
+	allErrs = append(allErrs, validateGenericSelector(m.Namespace, fldPath.Child("namespace"))...)
+	allErrs = append(allErrs, validateGenericSelector(m.Workspace, fldPath.Child("workspace"))...)
+	return allErrs
+}
+
+var supportedVolumeTypes = []string{string(VolumeTypePersistentVolumeClaim), string(VolumeTypeEphemeral)}
+
+var supportedVolumeModes = []string{string(corev1.PersistentVolumeFilesystem), string(corev1.PersistentVolumeBlock)}
+
+var supportedMatchPolicies = []string{string(MatchPolicyFirst), string(MatchPolicyAll)}
+
+func validateMatchPolicy(policy MatchPolicy, fldPath *field.Path) field.ErrorList {
+	switch policy {
+	case "", MatchPolicyFirst, MatchPolicyAll:
+		return nil
+	default:
+		return field.ErrorList{field.NotSupported(fldPath, policy, supportedMatchPolicies)}
+	}
+}
+
+var supportedModes = []string{string(InitializerModeEnforce), string(InitializerModeAudit)}
+
+func validateMode(mode InitializerMode, fldPath *field.Path) field.ErrorList {
+	switch mode {
+	case "", InitializerModeEnforce, InitializerModeAudit:
+		return nil
+	default:
+		return field.ErrorList{field.NotSupported(fldPath, mode, supportedModes)}
+	}
+}
+
+var supportedPositionTypes = []string{string(PositionPrepend), string(PositionAppend), string(PositionBefore), string(PositionAfter)}
+
+func validatePosition(position *InitContainerPosition, fldPath *field.Path) field.ErrorList {
+	if position == nil {
+		return nil
+	}
+	switch position.Type {
+	case PositionPrepend, PositionAppend:
+		return nil
+	case PositionBefore, PositionAfter:
+		if position.ContainerName == "" {
+			return field.ErrorList{field.Required(fldPath.Child("containerName"), "must be specified when `type` is 'Before' or 'After'")}
+		}
+		return nil
+	default:
+		return field.ErrorList{field.NotSupported(fldPath.Child("type"), position.Type, supportedPositionTypes)}
+	}
+}
+
+var (
+	supportedFieldSelectorKeys      = []string{FieldName, FieldNamespace}
+	supportedFieldSelectorOperators = []string{string(metav1.FieldSelectorOpIn), string(metav1.FieldSelectorOpNotIn)}
+)
+
+func validateGenericSelector(s *GenericSelector, fldPath *field.Path) field.ErrorList {
+	if s == nil {
+		return nil
+	}
+	var allErrs field.ErrorList
+
+	for i, req := range s.FieldSelector {
+		idxPath := fldPath.Child("fieldSelector").Index(i)
+		if req.Key != FieldName && req.Key != FieldNamespace {
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("key"), req.Key, supportedFieldSelectorKeys))
+		}
+		switch req.Operator {
+		case metav1.FieldSelectorOpIn, metav1.FieldSelectorOpNotIn:
+			if len(req.Values) == 0 {
+				allErrs = append(allErrs, field.Required(idxPath.Child("values"), "must be specified when `operator` is 'In' or 'NotIn'"))
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("operator"), req.Operator, supportedFieldSelectorOperators))
+		}
+	}
+
+	opts := metav1validation.LabelSelectorValidationOptions{}
+	for i, req := range s.LabelSelector {
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelectorRequirement(req, opts, fldPath.Child("labelSelector").Index(i))...)
+	}
+
+	return allErrs
+}
+
+var supportedFailurePolicies = []string{string(FailurePolicyFail), string(FailurePolicyIgnore)}
+
+func validateFailurePolicy(policy FailurePolicy, fldPath *field.Path) field.ErrorList {
+	switch policy {
+	case "", FailurePolicyFail, FailurePolicyIgnore:
+		return nil
+	default:
+		return field.ErrorList{field.NotSupported(fldPath, policy, supportedFailurePolicies)}
+	}
+}
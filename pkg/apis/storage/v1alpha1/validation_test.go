@@ -0,0 +1,206 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newValidInitializer() *Initializer {
+	return &Initializer{
+		ObjectMeta: metav1.ObjectMeta{Name: "chown"},
+		Spec: InitializerSpec{
+			Enabled:        true,
+			InitContainers: []corev1.Container{{Name: "chown", Image: "busybox"}, {Name: "chmod", Image: "busybox"}},
+			PVCMatchers:    []PVCMatcher{{Name: "all"}, {Name: "local"}},
+			PVCInitializers: []PVCInitializer{
+				{PVCMatcherName: "all", InitContainerName: "chown"},
+				{PVCMatcherName: "local", InitContainerName: "chmod"},
+			},
+		},
+	}
+}
+
+func TestValidateInitializer(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		mutate func(spec *InitializerSpec)
+		// errs are the fields of the expected errors along with their types
+		errs []string
+	}{
+		{
+			name:   "valid",
+			mutate: func(spec *InitializerSpec) {},
+		},
+		{
+			name: "valid enums",
+			mutate: func(spec *InitializerSpec) {
+				spec.MatchPolicy = MatchPolicyAll
+				spec.Mode = InitializerModeAudit
+				spec.FailurePolicy = FailurePolicyIgnore
+				spec.PVCMatchers[0].VolumeTypes = []VolumeType{VolumeTypePersistentVolumeClaim, VolumeTypeEphemeral}
+				spec.PVCMatchers[0].VolumeModes = []corev1.PersistentVolumeMode{corev1.PersistentVolumeFilesystem, corev1.PersistentVolumeBlock}
+				spec.PVCInitializers[0].MatchPolicy = MatchPolicyFirst
+				spec.PVCInitializers[0].FailurePolicy = FailurePolicyFail
+				spec.PVCInitializers[0].Position = &InitContainerPosition{Type: PositionBefore, ContainerName: "app"}
+			},
+		},
+		{
+			name: "duplicate init container",
+			mutate: func(spec *InitializerSpec) {
+				spec.InitContainers[1].Name = "chown"
+			},
+			// the pvcInitializer referencing chmod dangles now
+			errs: []string{
+				"spec.initContainers[1].name: FieldValueDuplicate",
+				"spec.pvcInitializers[1].initContainerName: FieldValueNotFound",
+			},
+		},
+		{
+			name: "duplicate pvcMatcher",
+			mutate: func(spec *InitializerSpec) {
+				spec.PVCMatchers[1].Name = "all"
+			},
+			errs: []string{
+				"spec.pvcMatchers[1].name: FieldValueDuplicate",
+				"spec.pvcInitializers[1].pvcMatcherName: FieldValueNotFound",
+			},
+		},
+		{
+			name: "missing names",
+			mutate: func(spec *InitializerSpec) {
+				spec.InitContainers[0].Name = ""
+				spec.PVCMatchers[0].Name = ""
+			},
+			errs: []string{
+				"spec.initContainers[0].name: FieldValueRequired",
+				"spec.pvcMatchers[0].name: FieldValueRequired",
+				"spec.pvcInitializers[0].pvcMatcherName: FieldValueNotFound",
+				"spec.pvcInitializers[0].initContainerName: FieldValueNotFound",
+			},
+		},
+		{
+			name: "missing references",
+			mutate: func(spec *InitializerSpec) {
+				spec.PVCInitializers[0].PVCMatcherName = ""
+				spec.PVCInitializers[0].InitContainerName = ""
+			},
+			errs: []string{
+				"spec.pvcInitializers[0].pvcMatcherName: FieldValueRequired",
+				"spec.pvcInitializers[0].initContainerName: FieldValueRequired",
+			},
+		},
+		{
+			name: "dangling references",
+			mutate: func(spec *InitializerSpec) {
+				spec.PVCInitializers[0].PVCMatcherName = "missing"
+				spec.PVCInitializers[1].InitContainerName = "missing"
+			},
+			errs: []string{
+				"spec.pvcInitializers[0].pvcMatcherName: FieldValueNotFound",
+				"spec.pvcInitializers[1].initContainerName: FieldValueNotFound",
+			},
+		},
+		{
+			name: "invalid pvcMatcher enums",
+			mutate: func(spec *InitializerSpec) {
+				spec.PVCMatchers[0].VolumeTypes = []VolumeType{VolumeTypeEphemeral, "hostPath"}
+				spec.PVCMatchers[0].VolumeModes = []corev1.PersistentVolumeMode{"Raw"}
+			},
+			errs: []string{
+				"spec.pvcMatchers[0].volumeTypes[1]: FieldValueNotSupported",
+				"spec.pvcMatchers[0].volumeModes[0]: FieldValueNotSupported",
+			},
+		},
+		{
+			name: "invalid Initializer enums",
+			mutate: func(spec *InitializerSpec) {
+				spec.MatchPolicy = "Last"
+				spec.Mode = "DryRun"
+				spec.FailurePolicy = "Retry"
+			},
+			errs: []string{
+				"spec.matchPolicy: FieldValueNotSupported",
+				"spec.mode: FieldValueNotSupported",
+				"spec.failurePolicy: FieldValueNotSupported",
+			},
+		},
+		{
+			name: "invalid pvcInitializer enums",
+			mutate: func(spec *InitializerSpec) {
+				spec.PVCInitializers[0].MatchPolicy = "Last"
+				spec.PVCInitializers[0].FailurePolicy = "Retry"
+				spec.PVCInitializers[1].Position = &InitContainerPosition{Type: "Middle"}
+			},
+			errs: []string{
+				"spec.pvcInitializers[0].matchPolicy: FieldValueNotSupported",
+				"spec.pvcInitializers[0].failurePolicy: FieldValueNotSupported",
+				"spec.pvcInitializers[1].position.type: FieldValueNotSupported",
+			},
+		},
+		{
+			name: "position without container",
+			mutate: func(spec *InitializerSpec) {
+				spec.PVCInitializers[0].Position = &InitContainerPosition{Type: PositionAfter}
+			},
+			errs: []string{"spec.pvcInitializers[0].position.containerName: FieldValueRequired"},
+		},
+		{
+			name: "invalid selectors",
+			mutate: func(spec *InitializerSpec) {
+				spec.PVCMatchers[0].PVC = &GenericSelector{
+					FieldSelector: []metav1.FieldSelectorRequirement{
+						{Key: "uid", Operator: metav1.FieldSelectorOpIn, Values: []string{"a"}},
+						{Key: FieldName, Operator: metav1.FieldSelectorOpIn},
+						{Key: FieldNamespace, Operator: "Exists"},
+					},
+				}
+				spec.PVCMatchers[1].Namespace = &GenericSelector{
+					LabelSelector: []metav1.LabelSelectorRequirement{{Key: "env", Operator: metav1.LabelSelectorOpIn}},
+				}
+			},
+			errs: []string{
+				"spec.pvcMatchers[0].pvc.fieldSelector[0].key: FieldValueNotSupported",
+				"spec.pvcMatchers[0].pvc.fieldSelector[1].values: FieldValueRequired",
+				"spec.pvcMatchers[0].pvc.fieldSelector[2].operator: FieldValueNotSupported",
+				"spec.pvcMatchers[1].namespace.labelSelector[0].values: FieldValueRequired",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			initializer := newValidInitializer()
+			tc.mutate(&initializer.Spec)
+			var errs []string
+			for _, err := range ValidateInitializer(initializer) {
+				errs = append(errs, err.Field+": "+string(err.Type))
+			}
+			if diff := cmp.Diff(tc.errs, errs); diff != "" {
+				t.Errorf("unexpected errors (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFindDanglingReferences(t *testing.T) {
+	spec := &newValidInitializer().Spec
+	if refs := FindDanglingReferences(spec); len(refs) != 0 {
+		t.Errorf("expected no dangling references, got %v", refs)
+	}
+
+	spec.PVCInitializers = append(spec.PVCInitializers,
+		PVCInitializer{PVCMatcherName: "missing", InitContainerName: "chown"},
+		PVCInitializer{PVCMatcherName: "all", InitContainerName: "missing"},
+		PVCInitializer{PVCMatcherName: "gone", InitContainerName: "gone"},
+	)
+	want := []DanglingReference{
+		{PVCInitializerIndex: 2, Field: FieldPVCMatcherName, Name: "missing"},
+		{PVCInitializerIndex: 3, Field: FieldInitContainerName, Name: "missing"},
+		{PVCInitializerIndex: 4, Field: FieldPVCMatcherName, Name: "gone"},
+		{PVCInitializerIndex: 4, Field: FieldInitContainerName, Name: "gone"},
+	}
+	if diff := cmp.Diff(want, FindDanglingReferences(spec)); diff != "" {
+		t.Errorf("unexpected dangling references (-want +got):\n%s", diff)
+	}
+}
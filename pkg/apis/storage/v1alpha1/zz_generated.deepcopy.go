@@ -26,6 +26,21 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DanglingReference) DeepCopyInto(out *DanglingReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DanglingReference.
+func (in *DanglingReference) DeepCopy() *DanglingReference {
+	if in == nil {
+		return nil
+	}
+	out := new(DanglingReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GenericSelector) DeepCopyInto(out *GenericSelector) {
 	*out = *in
@@ -55,13 +70,28 @@ func (in *GenericSelector) DeepCopy() *GenericSelector {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InitContainerPosition) DeepCopyInto(out *InitContainerPosition) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InitContainerPosition.
+func (in *InitContainerPosition) DeepCopy() *InitContainerPosition {
+	if in == nil {
+		return nil
+	}
+	out := new(InitContainerPosition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Initializer) DeepCopyInto(out *Initializer) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Initializer.
@@ -134,7 +164,9 @@ func (in *InitializerSpec) DeepCopyInto(out *InitializerSpec) {
 	if in.PVCInitializers != nil {
 		in, out := &in.PVCInitializers, &out.PVCInitializers
 		*out = make([]PVCInitializer, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 }
 
@@ -151,6 +183,22 @@ func (in *InitializerSpec) DeepCopy() *InitializerSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *InitializerStatus) DeepCopyInto(out *InitializerStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DanglingReferences != nil {
+		in, out := &in.DanglingReferences, &out.DanglingReferences
+		*out = make([]DanglingReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastInjectionTime != nil {
+		in, out := &in.LastInjectionTime, &out.LastInjectionTime
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InitializerStatus.
@@ -166,6 +214,16 @@ func (in *InitializerStatus) DeepCopy() *InitializerStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PVCInitializer) DeepCopyInto(out *PVCInitializer) {
 	*out = *in
+	if in.Priority != nil {
+		in, out := &in.Priority, &out.Priority
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Position != nil {
+		in, out := &in.Position, &out.Position
+		*out = new(InitContainerPosition)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PVCInitializer.
@@ -181,6 +239,16 @@ func (in *PVCInitializer) DeepCopy() *PVCInitializer {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PVCMatcher) DeepCopyInto(out *PVCMatcher) {
 	*out = *in
+	if in.VolumeTypes != nil {
+		in, out := &in.VolumeTypes, &out.VolumeTypes
+		*out = make([]VolumeType, len(*in))
+		copy(*out, *in)
+	}
+	if in.VolumeModes != nil {
+		in, out := &in.VolumeModes, &out.VolumeModes
+		*out = make([]corev1.PersistentVolumeMode, len(*in))
+		copy(*out, *in)
+	}
 	if in.PVC != nil {
 		in, out := &in.PVC, &out.PVC
 		*out = new(GenericSelector)
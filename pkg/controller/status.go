@@ -0,0 +1,263 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	"github.com/kubesphere/volume-initializer/pkg/generated/clientset/versioned"
+	informers "github.com/kubesphere/volume-initializer/pkg/generated/informers/externalversions"
+	listers "github.com/kubesphere/volume-initializer/pkg/generated/listers/storage/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ReasonReferencesResolved = "ReferencesResolved"
+	ReasonDanglingReferences = "DanglingReferences"
+	ReasonInvalidSpec        = "InvalidSpec"
+	ReasonActive             = "Active"
+	ReasonAuditing           = "Auditing"
+	ReasonDisabled           = "Disabled"
+	ReasonInvalid            = "Invalid"
+
+	// injectedPodsIndex indexes pods by the Initializers whose init containers were injected into them.
+	injectedPodsIndex = "injectedInitializers"
+)
+
+// StatusController keeps the status of Initializers up to date: it validates the spec,
+// sets the Valid and Ready conditions and counts the pods the webhook injected init containers into.
+// The counts are computed from the pods themselves, so that all replicas of the webhook agree on them.
+type StatusController struct {
+	client     versioned.Interface
+	lister     listers.InitializerLister
+	synced     cache.InformerSynced
+	pods       cache.Indexer
+	podsSynced cache.InformerSynced
+	queue      workqueue.TypedRateLimitingInterface[string]
+
+	// injectedInitializers returns the Initializers whose init containers were injected into a pod.
+	injectedInitializers cache.IndexFunc
+}
+
+// NewStatusController returns a StatusController counting the pods of podInformer by injectedInitializers,
+// which must be registered before podInformer is started.
+func NewStatusController(client versioned.Interface, informerFactory informers.SharedInformerFactory,
+	podInformer cache.SharedIndexInformer, injectedInitializers cache.IndexFunc) (*StatusController, error) {
+	informer := informerFactory.Storage().V1alpha1().Initializers()
+	c := &StatusController{
+		client:               client,
+		lister:               informer.Lister(),
+		synced:               informer.Informer().HasSynced,
+		pods:                 podInformer.GetIndexer(),
+		podsSynced:           podInformer.HasSynced,
+		injectedInitializers: injectedInitializers,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: "initializer-status"},
+		),
+	}
+
+	_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(_, newObj interface{}) {
+			c.enqueue(newObj)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = podInformer.AddIndexers(cache.Indexers{injectedPodsIndex: injectedInitializers}); err != nil {
+		return nil, err
+	}
+	_, err = podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		// the annotation is set at admission, so the pods only need to be counted again when they come and go
+		AddFunc: c.enqueueInjected,
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			c.enqueueInjected(obj)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *StatusController) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// enqueueInjected enqueues the Initializers whose init containers were injected into the pod.
+func (c *StatusController) enqueueInjected(obj interface{}) {
+	initializers, err := c.injectedInitializers(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, name := range initializers {
+		c.queue.Add(name)
+	}
+}
+
+// Run starts the workers and blocks until the context is done.
+func (c *StatusController) Run(ctx context.Context, workers int) error {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.Info("Starting initializer status controller")
+	if !cache.WaitForCacheSync(ctx.Done(), c.synced, c.podsSynced) {
+		return fmt.Errorf("failed to wait for initializer caches to sync")
+	}
+
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	}
+
+	<-ctx.Done()
+	klog.Info("Shutting down initializer status controller")
+	return nil
+}
+
+func (c *StatusController) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+func (c *StatusController) processNextItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	err := c.sync(ctx, key)
+	if err == nil {
+		c.queue.Forget(key)
+		return true
+	}
+	klog.ErrorS(err, "failed to sync initializer status", "initializer", key)
+	c.queue.AddRateLimited(key)
+	return true
+}
+
+func (c *StatusController) sync(ctx context.Context, name string) error {
+	initializer, err := c.lister.Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	status := initializer.Status.DeepCopy()
+	setStatusConditions(initializer, status)
+
+	if err = c.setInjections(name, status); err != nil {
+		return err
+	}
+
+	if equality.Semantic.DeepEqual(status, &initializer.Status) {
+		return nil
+	}
+
+	updated := initializer.DeepCopy()
+	updated.Status = *status
+	_, err = c.client.StorageV1alpha1().Initializers().UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	klog.V(4).Infof("updated status of initializer %s", name)
+	return nil
+}
+
+// setInjections counts the pods the init containers of the initializer were injected into, and sets lastInjectionTime
+// to the creation of the newest one. lastInjectionTime is kept when the pods are deleted.
+func (c *StatusController) setInjections(name string, status *v1alpha1.InitializerStatus) error {
+	pods, err := c.pods.ByIndex(injectedPodsIndex, name)
+	if err != nil {
+		return err
+	}
+	status.InjectedPods = int64(len(pods))
+	for _, obj := range pods {
+		pod, err := meta.Accessor(obj)
+		if err != nil {
+			return err
+		}
+		created := pod.GetCreationTimestamp()
+		if status.LastInjectionTime == nil || created.After(status.LastInjectionTime.Time) {
+			status.LastInjectionTime = &created
+		}
+	}
+	return nil
+}
+
+// setStatusConditions validates the spec of the initializer and sets observedGeneration,
+// danglingReferences and the Valid and Ready conditions accordingly.
+func setStatusConditions(initializer *v1alpha1.Initializer, status *v1alpha1.InitializerStatus) {
+	generation := initializer.Generation
+	status.ObservedGeneration = generation
+	status.DanglingReferences = v1alpha1.FindDanglingReferences(&initializer.Spec)
+
+	valid := metav1.Condition{
+		Type:               v1alpha1.ConditionValid,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonReferencesResolved,
+		Message:            "spec is valid and all references in pvcInitializers are resolved",
+		ObservedGeneration: generation,
+	}
+	switch errs := v1alpha1.ValidateInitializer(initializer); {
+	case len(status.DanglingReferences) > 0:
+		var refs []string
+		for _, ref := range status.DanglingReferences {
+			refs = append(refs, fmt.Sprintf("pvcInitializers[%d].%s=%q", ref.PVCInitializerIndex, ref.Field, ref.Name))
+		}
+		valid.Status = metav1.ConditionFalse
+		valid.Reason = ReasonDanglingReferences
+		valid.Message = "unresolved references: " + strings.Join(refs, ", ")
+	case len(errs) > 0:
+		valid.Status = metav1.ConditionFalse
+		valid.Reason = ReasonInvalidSpec
+		valid.Message = errs.ToAggregate().Error()
+	}
+	meta.SetStatusCondition(&status.Conditions, valid)
+
+	ready := metav1.Condition{
+		Type:               v1alpha1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonActive,
+		Message:            "initializer takes part in pod admission",
+		ObservedGeneration: generation,
+	}
+	switch {
+	case !initializer.Spec.Enabled:
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = ReasonDisabled
+		ready.Message = "initializer is not enabled"
+	case valid.Status != metav1.ConditionTrue:
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = ReasonInvalid
+		ready.Message = "initializer is not valid"
+	case initializer.Spec.Mode == v1alpha1.InitializerModeAudit:
+		ready.Reason = ReasonAuditing
+		ready.Message = "initializer takes part in pod admission in Audit mode, its init containers are not injected"
+	}
+	meta.SetStatusCondition(&status.Conditions, ready)
+}
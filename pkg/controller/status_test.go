@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	"github.com/kubesphere/volume-initializer/pkg/generated/clientset/versioned/fake"
+	informers "github.com/kubesphere/volume-initializer/pkg/generated/informers/externalversions"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// annotationInitializers lists the Initializers injected into the test pods, separated by commas,
+// in place of the annotation of the webhook.
+const annotationInitializers = "initializers"
+
+func injectedInitializers(obj interface{}) ([]string, error) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	if value := m.GetAnnotations()[annotationInitializers]; value != "" {
+		return strings.Split(value, ","), nil
+	}
+	return nil, nil
+}
+
+// newTestController returns a StatusController whose informers hold the initializer and pods without being started,
+// along with the fake client it updates the status with.
+func newTestController(t *testing.T, initializer *v1alpha1.Initializer, pods ...*metav1.PartialObjectMetadata) (*StatusController, *fake.Clientset) {
+	t.Helper()
+	client := fake.NewSimpleClientset(initializer)
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	podInformer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &metav1.PartialObjectMetadata{}, 0, cache.Indexers{})
+	c, err := NewStatusController(client, informerFactory, podInformer, injectedInitializers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = informerFactory.Storage().V1alpha1().Initializers().Informer().GetIndexer().Add(initializer); err != nil {
+		t.Fatal(err)
+	}
+	for _, pod := range pods {
+		if err = podInformer.GetIndexer().Add(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c, client
+}
+
+func newTestInitializer() *v1alpha1.Initializer {
+	return &v1alpha1.Initializer{
+		ObjectMeta: metav1.ObjectMeta{Name: "chown", Generation: 3},
+		Spec: v1alpha1.InitializerSpec{
+			Enabled:         true,
+			InitContainers:  []corev1.Container{{Name: "chown", Image: "busybox"}},
+			PVCMatchers:     []v1alpha1.PVCMatcher{{Name: "all"}},
+			PVCInitializers: []v1alpha1.PVCInitializer{{PVCMatcherName: "all", InitContainerName: "chown"}},
+		},
+	}
+}
+
+func newTestPod(name string, created time.Time, initializers ...string) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{
+		Name:              name,
+		Namespace:         "default",
+		CreationTimestamp: metav1.NewTime(created),
+		Annotations:       map[string]string{annotationInitializers: strings.Join(initializers, ",")},
+	}}
+}
+
+func TestSync(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	valid := metav1.Condition{Type: v1alpha1.ConditionValid, Status: metav1.ConditionTrue, Reason: ReasonReferencesResolved, ObservedGeneration: 3}
+	for _, tc := range []struct {
+		name        string
+		initializer func(*v1alpha1.Initializer)
+		pods        []*metav1.PartialObjectMetadata
+		want        v1alpha1.InitializerStatus
+	}{
+		{
+			name: "active",
+			pods: []*metav1.PartialObjectMetadata{
+				newTestPod("a", now.Add(-time.Hour), "chown"),
+				newTestPod("b", now, "chmod", "chown"),
+				newTestPod("c", now.Add(time.Hour), "chmod"),
+				newTestPod("d", now.Add(time.Hour)),
+			},
+			want: v1alpha1.InitializerStatus{
+				ObservedGeneration: 3,
+				Conditions: []metav1.Condition{
+					valid,
+					{Type: v1alpha1.ConditionReady, Status: metav1.ConditionTrue, Reason: ReasonActive, ObservedGeneration: 3},
+				},
+				InjectedPods:      2,
+				LastInjectionTime: &metav1.Time{Time: now},
+			},
+		},
+		{
+			name:        "auditing",
+			initializer: func(i *v1alpha1.Initializer) { i.Spec.Mode = v1alpha1.InitializerModeAudit },
+			want: v1alpha1.InitializerStatus{
+				ObservedGeneration: 3,
+				Conditions: []metav1.Condition{
+					valid,
+					{Type: v1alpha1.ConditionReady, Status: metav1.ConditionTrue, Reason: ReasonAuditing, ObservedGeneration: 3},
+				},
+			},
+		},
+		{
+			name:        "disabled",
+			initializer: func(i *v1alpha1.Initializer) { i.Spec.Enabled = false },
+			want: v1alpha1.InitializerStatus{
+				ObservedGeneration: 3,
+				Conditions: []metav1.Condition{
+					valid,
+					{Type: v1alpha1.ConditionReady, Status: metav1.ConditionFalse, Reason: ReasonDisabled, ObservedGeneration: 3},
+				},
+			},
+		},
+		{
+			name: "dangling references",
+			initializer: func(i *v1alpha1.Initializer) {
+				i.Spec.PVCInitializers = append(i.Spec.PVCInitializers, v1alpha1.PVCInitializer{PVCMatcherName: "local", InitContainerName: "chmod"})
+			},
+			want: v1alpha1.InitializerStatus{
+				ObservedGeneration: 3,
+				Conditions: []metav1.Condition{
+					{Type: v1alpha1.ConditionValid, Status: metav1.ConditionFalse, Reason: ReasonDanglingReferences, ObservedGeneration: 3},
+					{Type: v1alpha1.ConditionReady, Status: metav1.ConditionFalse, Reason: ReasonInvalid, ObservedGeneration: 3},
+				},
+				DanglingReferences: []v1alpha1.DanglingReference{
+					{PVCInitializerIndex: 1, Field: v1alpha1.FieldPVCMatcherName, Name: "local"},
+					{PVCInitializerIndex: 1, Field: v1alpha1.FieldInitContainerName, Name: "chmod"},
+				},
+			},
+		},
+		{
+			name: "invalid spec",
+			initializer: func(i *v1alpha1.Initializer) {
+				i.Spec.PVCMatchers = append(i.Spec.PVCMatchers, v1alpha1.PVCMatcher{Name: "all"})
+			},
+			want: v1alpha1.InitializerStatus{
+				ObservedGeneration: 3,
+				Conditions: []metav1.Condition{
+					{Type: v1alpha1.ConditionValid, Status: metav1.ConditionFalse, Reason: ReasonInvalidSpec, ObservedGeneration: 3},
+					{Type: v1alpha1.ConditionReady, Status: metav1.ConditionFalse, Reason: ReasonInvalid, ObservedGeneration: 3},
+				},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			initializer := newTestInitializer()
+			if tc.initializer != nil {
+				tc.initializer(initializer)
+			}
+			c, client := newTestController(t, initializer, tc.pods...)
+			if err := c.sync(context.Background(), initializer.Name); err != nil {
+				t.Fatal(err)
+			}
+
+			updated, err := client.StorageV1alpha1().Initializers().Get(context.Background(), initializer.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime", "Message")
+			if diff := cmp.Diff(tc.want, updated.Status, opts); diff != "" {
+				t.Errorf("unexpected status (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSyncUnchanged(t *testing.T) {
+	initializer := newTestInitializer()
+	setStatusConditions(initializer, &initializer.Status)
+	c, client := newTestController(t, initializer)
+	if err := c.sync(context.Background(), initializer.Name); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.sync(context.Background(), "deleted"); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" {
+			t.Errorf("expected the status not to be updated, got %v", action)
+		}
+	}
+}
+
+func TestEnqueueInjected(t *testing.T) {
+	c, _ := newTestController(t, newTestInitializer())
+	// the Initializers injected into a pod are counted again when it comes and goes
+	c.enqueueInjected(newTestPod("a", time.Now(), "chmod", "chown"))
+	var got []string
+	for c.queue.Len() > 0 {
+		key, _ := c.queue.Get()
+		got = append(got, key)
+		c.queue.Done(key)
+	}
+	if diff := cmp.Diff([]string{"chmod", "chown"}, got); diff != "" {
+		t.Errorf("unexpected keys (-want +got):\n%s", diff)
+	}
+}
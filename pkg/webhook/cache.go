@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const crdInitializersName = "initializers.storage.kubesphere.io"
+
+// cachedReader reads objects from a shared informer cache once it is synced, and from the API server before that.
+// PVCs not found in the cache are read from the API server, as they may have just been created.
+type cachedReader struct {
+	cache  cache.Cache
+	live   client.Reader
+	synced atomic.Bool
+}
+
+var _ client.Reader = (*cachedReader)(nil)
+
+func newCachedReader(cfg *rest.Config) (*cachedReader, error) {
+	informerCache, err := cache.New(cfg, cache.Options{
+		Scheme:           scheme,
+		DefaultTransform: cache.TransformStripManagedFields(),
+		ByObject: map[client.Object]cache.ByObject{
+			// only the Initializer CRD is needed, don't cache the others
+			&apiextensionsv1.CustomResourceDefinition{}: {
+				Field: fields.OneTermEqualSelector("metadata.name", crdInitializersName),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	live, err := client.New(cfg, client.Options{
+		Scheme: scheme,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cachedReader{
+		cache: informerCache,
+		live:  live,
+	}, nil
+}
+
+// Start starts the informers and blocks until the context is done.
+// Workspaces are cached on first use, as they only exist in KubeSphere clusters.
+func (r *cachedReader) Start(ctx context.Context) error {
+	for _, obj := range []client.Object{
+		&apiextensionsv1.CustomResourceDefinition{},
+		&v1alpha1.Initializer{},
+		&corev1.PersistentVolumeClaim{},
+		&storagev1.StorageClass{},
+		&corev1.Namespace{},
+		&appsv1.StatefulSet{},
+	} {
+		if _, err := r.cache.GetInformer(ctx, obj, cache.BlockUntilSynced(false)); err != nil {
+			return fmt.Errorf("failed to get informer for %T: %w", obj, err)
+		}
+	}
+
+	go func() {
+		if r.cache.WaitForCacheSync(ctx) {
+			klog.Info("Informer caches synced")
+			r.synced.Store(true)
+		}
+	}()
+	return r.cache.Start(ctx)
+}
+
+// HasSynced returns whether the informer caches are synced, reads go to the API server until then.
+func (r *cachedReader) HasSynced() bool {
+	return r.synced.Load()
+}
+
+func (r *cachedReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	start := time.Now()
+	if !r.synced.Load() {
+		err := r.live.Get(ctx, key, obj, opts...)
+		observeLookup(obj, "get", sourceAPIServer, cacheNotSynced, start)
+		return err
+	}
+	err := r.cache.Get(ctx, key, obj, opts...)
+	if _, ok := obj.(*corev1.PersistentVolumeClaim); ok && errors.IsNotFound(err) {
+		// the miss is counted once, along with the read from the API server
+		observeLookup(obj, "get", sourceCache, "", start)
+		klog.V(4).Infof("pvc %s not found in cache, read it from API server", key)
+		start = time.Now()
+		err = r.live.Get(ctx, key, obj, opts...)
+		observeLookup(obj, "get", sourceAPIServer, cacheMiss, start)
+		return err
+	}
+	observeLookup(obj, "get", sourceCache, cacheResult(err), start)
+	return err
+}
+
+func (r *cachedReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	start := time.Now()
+	if !r.synced.Load() {
+		err := r.live.List(ctx, list, opts...)
+		observeLookup(list, "list", sourceAPIServer, cacheNotSynced, start)
+		return err
+	}
+	err := r.cache.List(ctx, list, opts...)
+	observeLookup(list, "list", sourceCache, cacheResult(err), start)
+	return err
+}
+
+// cacheResult returns the result of a cache lookup which returned err.
+func cacheResult(err error) string {
+	switch {
+	case err == nil:
+		return cacheHit
+	case errors.IsNotFound(err):
+		return cacheMiss
+	default:
+		return cacheError
+	}
+}
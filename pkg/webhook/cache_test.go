@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// fakeCache reads objects from a fake client, its other methods are not implemented.
+type fakeCache struct {
+	cache.Cache
+	reader client.Reader
+}
+
+func (c *fakeCache) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	return c.reader.Get(ctx, key, obj, opts...)
+}
+
+func (c *fakeCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return c.reader.List(ctx, list, opts...)
+}
+
+func TestCachedReaderGet(t *testing.T) {
+	cached := newTestPVC("cached")
+	created := newTestPVC("created")
+	for _, tc := range []struct {
+		name     string
+		synced   bool
+		obj      client.Object
+		key      string
+		cacheErr error
+		// wantResult is the result label the lookup is counted with
+		wantResult string
+		wantLive   bool
+		wantErr    bool
+	}{
+		{name: "not synced", obj: &corev1.PersistentVolumeClaim{}, key: "cached", wantResult: cacheNotSynced, wantLive: true},
+		{name: "hit", synced: true, obj: &corev1.PersistentVolumeClaim{}, key: "cached", wantResult: cacheHit},
+		// a PVC may have just been created, it's read from the API server
+		{name: "pvc miss", synced: true, obj: &corev1.PersistentVolumeClaim{}, key: "created", wantResult: cacheMiss, wantLive: true},
+		{name: "miss", synced: true, obj: &corev1.Namespace{}, key: "missing", wantResult: cacheMiss, wantErr: true},
+		{
+			name:       "error",
+			synced:     true,
+			obj:        &corev1.PersistentVolumeClaim{},
+			key:        "cached",
+			cacheErr:   apierrors.NewServiceUnavailable("unavailable"),
+			wantResult: cacheError,
+			wantErr:    true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			funcs := interceptor.Funcs{}
+			if tc.cacheErr != nil {
+				funcs.Get = func(context.Context, client.WithWatch, client.ObjectKey, client.Object, ...client.GetOption) error {
+					return tc.cacheErr
+				}
+			}
+			liveReads := 0
+			r := &cachedReader{
+				cache: &fakeCache{reader: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cached).WithInterceptorFuncs(funcs).Build()},
+				live: fake.NewClientBuilder().WithScheme(scheme).WithObjects(cached, created).WithInterceptorFuncs(interceptor.Funcs{
+					Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+						liveReads++
+						return c.Get(ctx, key, obj, opts...)
+					},
+				}).Build(),
+			}
+			r.synced.Store(tc.synced)
+			kind := "PersistentVolumeClaim"
+			if _, ok := tc.obj.(*corev1.Namespace); ok {
+				kind = "Namespace"
+			}
+			counter := cacheLookupsTotal.WithLabelValues(kind, tc.wantResult)
+			before := testutil.ToFloat64(counter)
+
+			err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: tc.key}, tc.obj)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %t, got %v", tc.wantErr, err)
+			}
+			if err == nil && tc.obj.GetName() != tc.key {
+				t.Errorf("expected %s, got %q", tc.key, tc.obj.GetName())
+			}
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("expected the lookup to be counted once as %s, got %v", tc.wantResult, got)
+			}
+			if (liveReads > 0) != tc.wantLive {
+				t.Errorf("expected a read from the API server %t, got %d", tc.wantLive, liveReads)
+			}
+		})
+	}
+}
+
+func TestCachedReaderList(t *testing.T) {
+	r := &cachedReader{
+		cache: &fakeCache{reader: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		).Build()},
+	}
+	r.synced.Store(true)
+	counter := cacheLookupsTotal.WithLabelValues("Namespace", cacheHit)
+	before := testutil.ToFloat64(counter)
+
+	list := &corev1.NamespaceList{}
+	if err := r.List(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 {
+		t.Errorf("expected 1 namespace, got %d", len(list.Items))
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("expected the list to be counted once as a hit, got %v", got)
+	}
+}
@@ -1,11 +1,18 @@
 package webhook
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 )
 
@@ -14,14 +21,32 @@ import (
 // with controller-runtime/pkg/webhook directly, as it would require extensive rework:
 // https://github.com/kubernetes-csi/external-snapshotter/issues/422
 
+// kubeletDataDir is the symlink kubelet atomically swaps to update all the files of a mounted Secret or ConfigMap,
+// the files themselves are symlinks into it.
+const kubeletDataDir = "..data"
+
+// defaultCertPollInterval is how often watched files are checked for changes,
+// in case a change is not notified.
+const defaultCertPollInterval = time.Minute
+
 // CertWatcher watches certificate and key files for changes.  When either file
-// changes, it reads and parses both and calls an optional callback with the new
-// certificate.
+// changes, it reads and parses both, and swaps the current certificate if they
+// make a valid key pair.
+//
+// The directories of the files are watched rather than the files themselves, so that
+// replacing the files, e.g. by kubelet swapping the ..data symlink of a mounted Secret,
+// is noticed. The files are also polled in case an event is missed.
 type CertWatcher struct {
 	sync.Mutex
 
 	currentCert *tls.Certificate
-	watcher     *fsnotify.Watcher
+	currentLeaf *x509.Certificate
+	// certPEM and keyPEM are the contents of the files currentCert was loaded from
+	certPEM []byte
+	keyPEM  []byte
+
+	watcher      *fsnotify.Watcher
+	pollInterval time.Duration
 
 	certPath string
 	keyPath  string
@@ -32,8 +57,9 @@ func NewCertWatcher(certPath, keyPath string) (*CertWatcher, error) {
 	var err error
 
 	cw := &CertWatcher{
-		certPath: certPath,
-		keyPath:  keyPath,
+		certPath:     certPath,
+		keyPath:      keyPath,
+		pollInterval: defaultCertPollInterval,
 	}
 
 	// Initial read of certificate and key.
@@ -56,82 +82,121 @@ func (cw *CertWatcher) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate,
 	return cw.currentCert, nil
 }
 
-// Start starts the watch on the certificate and key files.
-func (cw *CertWatcher) Start(ctx context.Context) error {
-	files := []string{cw.certPath, cw.keyPath}
-
-	for _, f := range files {
-		if err := cw.watcher.Add(f); err != nil {
-			return err
-		}
+// NotAfter returns the expiry time of the currently loaded certificate.
+func (cw *CertWatcher) NotAfter() time.Time {
+	cw.Lock()
+	defer cw.Unlock()
+	if cw.currentLeaf == nil {
+		return time.Time{}
 	}
-
-	go cw.Watch()
-
-	// Block until the context is done.
-	<-ctx.Done()
-
-	return cw.watcher.Close()
+	return cw.currentLeaf.NotAfter
 }
 
-// Watch reads events from the watcher's channel and reacts to changes.
-func (cw *CertWatcher) Watch() {
-	for {
-		select {
-		case event, ok := <-cw.watcher.Events:
-			// Channel is closed.
-			if !ok {
-				return
-			}
-
-			cw.handleEvent(event)
-
-		case err, ok := <-cw.watcher.Errors:
-			// Channel is closed.
-			if !ok {
-				return
-			}
-
-			klog.ErrorS(err, "certificate watch failed")
-		}
-	}
+// Start starts the watch on the directories of the certificate and key files.
+func (cw *CertWatcher) Start(ctx context.Context) error {
+	return watchFiles(ctx, cw.watcher, []string{cw.certPath, cw.keyPath}, cw.pollInterval, cw.ReadCertificate)
 }
 
 // ReadCertificate reads the certificate and key files from disk, parses them,
-// and updates the current certificate on the watcher.  If a callback is set, it
-// is invoked with the new certificate.
+// and updates the current certificate on the watcher if they changed. The current
+// certificate is kept if the files don't make a valid key pair, e.g. when only
+// one of them has been updated yet.
 func (cw *CertWatcher) ReadCertificate() error {
-	cert, err := tls.LoadX509KeyPair(cw.certPath, cw.keyPath)
+	certPEM, err := os.ReadFile(cw.certPath)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := os.ReadFile(cw.keyPath)
+	if err != nil {
+		return err
+	}
+
+	cw.Lock()
+	unchanged := bytes.Equal(certPEM, cw.certPEM) && bytes.Equal(keyPEM, cw.keyPEM)
+	cw.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	// X509KeyPair fails if the private key doesn't match the public key of the certificate
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("invalid certificate and key pair, keep serving the current certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
 	if err != nil {
 		return err
 	}
+	if time.Now().After(leaf.NotAfter) {
+		klog.Warningf("certificate %s expired at %s", cw.certPath, leaf.NotAfter)
+	}
 
 	cw.Lock()
 	cw.currentCert = &cert
+	cw.currentLeaf = leaf
+	cw.certPEM = certPEM
+	cw.keyPEM = keyPEM
 	cw.Unlock()
+	certificateExpiryTimestamp.Set(float64(leaf.NotAfter.Unix()))
 
-	klog.Info("Updated current TLS certificate")
+	klog.InfoS("Updated current TLS certificate", "notAfter", leaf.NotAfter)
 
 	return nil
 }
 
-func (cw *CertWatcher) handleEvent(event fsnotify.Event) {
-	// Only care about events which may modify the contents of the file.
-	if !(isWrite(event) || isRemove(event) || isCreate(event)) {
-		return
+// watchFiles watches the directories of the files at paths, and calls reload whenever one of the files or
+// the ..data symlink they point into changes, and every pollInterval in case an event is missed.
+// It blocks until the context is done, and closes the watcher.
+func watchFiles(ctx context.Context, watcher *fsnotify.Watcher, paths []string, pollInterval time.Duration, reload func() error) error {
+	names := sets.New(kubeletDataDir)
+	dirs := sets.New[string]()
+	for _, p := range paths {
+		names.Insert(filepath.Base(p))
+		dirs.Insert(filepath.Dir(p))
 	}
-
-	klog.V(1).Info("certificate event", "event", event)
-
-	// If the file was removed, re-add the watch.
-	if isRemove(event) {
-		if err := cw.watcher.Add(event.Name); err != nil {
-			klog.ErrorS(err, "failed to re-watching file")
+	for _, d := range sets.List(dirs) {
+		if err := watcher.Add(d); err != nil {
+			return err
 		}
 	}
 
-	if err := cw.ReadCertificate(); err != nil {
-		klog.ErrorS(err, "failed to re-reading certificate")
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	defer watcher.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			// Channel is closed.
+			if !ok {
+				return nil
+			}
+			// Only care about events which may modify the contents of the files.
+			if !(isWrite(event) || isRemove(event) || isCreate(event) || isRename(event)) {
+				continue
+			}
+			if !names.Has(filepath.Base(event.Name)) {
+				continue
+			}
+			klog.V(1).InfoS("file event", "event", event)
+			if err := reload(); err != nil {
+				klog.ErrorS(err, "failed to reload", "paths", paths)
+			}
+
+		case err, ok := <-watcher.Errors:
+			// Channel is closed.
+			if !ok {
+				return nil
+			}
+			klog.ErrorS(err, "file watch failed", "paths", paths)
+
+		case <-ticker.C:
+			if err := reload(); err != nil {
+				klog.ErrorS(err, "failed to reload", "paths", paths)
+			}
+		}
 	}
 }
 
@@ -146,3 +211,7 @@ func isCreate(event fsnotify.Event) bool {
 func isRemove(event fsnotify.Event) bool {
 	return event.Op&fsnotify.Remove == fsnotify.Remove
 }
+
+func isRename(event fsnotify.Event) bool {
+	return event.Op&fsnotify.Rename == fsnotify.Rename
+}
@@ -0,0 +1,139 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// writeKubeletSecret writes the certificate and key into a new timestamped directory of dir, and atomically swaps
+// the ..data symlink to it, the way kubelet updates a mounted Secret. The files in dir are symlinks into ..data.
+func writeKubeletSecret(t *testing.T, dir, version string, bundle *certBundle) {
+	t.Helper()
+	dataDir := filepath.Join(dir, "..2024_01_01_00_00_00."+version)
+	if err := os.Mkdir(dataDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "tls.crt"), bundle.certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "tls.key"), bundle.keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(filepath.Base(dataDir), tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, kubeletDataDir)); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"tls.crt", "tls.key"} {
+		if _, err := os.Lstat(filepath.Join(dir, name)); os.IsNotExist(err) {
+			if err = os.Symlink(filepath.Join(kubeletDataDir, name), filepath.Join(dir, name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func newTestCertBundle(t *testing.T) *certBundle {
+	t.Helper()
+	bundle, err := newCertBundle(nil, []string{"localhost"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+// servedCertificate returns the DER of the certificate cw serves.
+func servedCertificate(t *testing.T, cw *CertWatcher) []byte {
+	t.Helper()
+	cert, err := cw.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Certificate[0]
+}
+
+func TestCertWatcherSymlinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	first, second := newTestCertBundle(t), newTestCertBundle(t)
+	writeKubeletSecret(t, dir, "1", first)
+
+	cw, err := NewCertWatcher(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only events can reload the certificate in time
+	cw.pollInterval = time.Hour
+	if !bytes.Equal(servedCertificate(t, cw), first.cert.Raw) {
+		t.Fatal("expected the first certificate to be served")
+	}
+	if !cw.NotAfter().Equal(first.cert.NotAfter) {
+		t.Errorf("expected NotAfter %s, got %s", first.cert.NotAfter, cw.NotAfter())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- cw.Start(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+	// the watch starts asynchronously, swap until it's noticed
+	deadline := time.Now().Add(10 * time.Second)
+	for version := 2; !bytes.Equal(servedCertificate(t, cw), second.cert.Raw); version++ {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the certificate to be reloaded after the ..data symlink swap")
+		}
+		writeKubeletSecret(t, dir, strconv.Itoa(version), second)
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !cw.NotAfter().Equal(second.cert.NotAfter) {
+		t.Errorf("expected NotAfter %s, got %s", second.cert.NotAfter, cw.NotAfter())
+	}
+}
+
+func TestCertWatcherMismatchedKeyPair(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	first, second := newTestCertBundle(t), newTestCertBundle(t)
+	if err := os.WriteFile(certFile, first.certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, first.keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cw, err := NewCertWatcher(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the certificate is updated yet
+	if err = os.WriteFile(certFile, second.certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = cw.ReadCertificate(); err == nil {
+		t.Error("expected an error for a certificate which doesn't match the key")
+	}
+	if !bytes.Equal(servedCertificate(t, cw), first.cert.Raw) {
+		t.Error("expected the current certificate to be kept")
+	}
+
+	// then the key
+	if err = os.WriteFile(keyFile, second.keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = cw.ReadCertificate(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(servedCertificate(t, cw), second.cert.Raw) {
+		t.Error("expected the new certificate once the key matches")
+	}
+}
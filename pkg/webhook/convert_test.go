@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	fuzz "github.com/google/gofuzz"
+	v1 "k8s.io/api/admission/v1"
+	"k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fuzzRawExtension fuzzes only the raw bytes of RawExtensions, as Object is an interface.
+func fuzzRawExtension(r *runtime.RawExtension, c fuzz.Continue) {
+	c.Fuzz(&r.Raw)
+}
+
+func TestConvertAdmissionRequestToV1(t *testing.T) {
+	f := fuzz.New().Funcs(fuzzRawExtension)
+	for i := 0; i < 100; i++ {
+		t.Run(fmt.Sprintf("Run %d/100", i), func(t *testing.T) {
+			orig := &v1beta1.AdmissionRequest{}
+			f.Fuzz(orig)
+			converted := convertAdmissionRequestToV1(orig)
+			rt := convertAdmissionRequestToV1beta1(converted)
+			if !reflect.DeepEqual(orig, rt) {
+				t.Errorf("expected all request fields to be in converted object but found differences: %v", cmp.Diff(orig, rt))
+			}
+		})
+	}
+}
+
+func TestConvertAdmissionResponseToV1beta1(t *testing.T) {
+	f := fuzz.New()
+	for i := 0; i < 100; i++ {
+		t.Run(fmt.Sprintf("Run %d/100", i), func(t *testing.T) {
+			orig := &v1.AdmissionResponse{}
+			f.Fuzz(orig)
+			converted := convertAdmissionResponseToV1beta1(orig)
+			rt := convertAdmissionResponseToV1(converted)
+			if !reflect.DeepEqual(orig, rt) {
+				t.Errorf("expected all response fields to be in converted object but found differences: %v", cmp.Diff(orig, rt))
+			}
+		})
+	}
+}
+
+func TestServerAdmissionReviewVersions(t *testing.T) {
+	patch := []byte(`[{"op":"add","path":"/metadata/labels","value":{"a":"b"}}]`)
+	var admitted *v1.AdmissionRequest
+	handler := newDelegateToV1AdmitHandler(func(ar v1.AdmissionReview) *v1.AdmissionResponse {
+		admitted = ar.Request
+		return toV1AdmissionResponseWithPatch(patch)
+	})
+	request := func() v1.AdmissionRequest {
+		return v1.AdmissionRequest{
+			UID:       types.UID("uid-1"),
+			Namespace: "default",
+			Operation: v1.Create,
+			Object:    runtime.RawExtension{Raw: []byte(`{"apiVersion":"v1","kind":"Pod"}`)},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		review runtime.Object
+		decode func(t *testing.T, body []byte) *v1.AdmissionResponse
+	}{
+		{
+			name: "v1",
+			review: &v1.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: v1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+				Request:  ptrTo(request()),
+			},
+			decode: func(t *testing.T, body []byte) *v1.AdmissionResponse {
+				review := &v1.AdmissionReview{}
+				if err := json.Unmarshal(body, review); err != nil {
+					t.Fatal(err)
+				}
+				if review.APIVersion != v1.SchemeGroupVersion.String() {
+					t.Errorf("expected apiVersion %s, got %s", v1.SchemeGroupVersion, review.APIVersion)
+				}
+				return review.Response
+			},
+		},
+		{
+			name: "v1beta1",
+			review: &v1beta1.AdmissionReview{
+				TypeMeta: metav1.TypeMeta{APIVersion: v1beta1.SchemeGroupVersion.String(), Kind: "AdmissionReview"},
+				Request:  convertAdmissionRequestToV1beta1(ptrTo(request())),
+			},
+			decode: func(t *testing.T, body []byte) *v1.AdmissionResponse {
+				review := &v1beta1.AdmissionReview{}
+				if err := json.Unmarshal(body, review); err != nil {
+					t.Fatal(err)
+				}
+				if review.APIVersion != v1beta1.SchemeGroupVersion.String() {
+					t.Errorf("expected apiVersion %s, got %s", v1beta1.SchemeGroupVersion, review.APIVersion)
+				}
+				return convertAdmissionResponseToV1(review.Response)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admitted = nil
+			body, err := json.Marshal(tt.review)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/pods", bytes.NewReader(body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			server(w, r, handler)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			if expected := request(); !reflect.DeepEqual(admitted, &expected) {
+				t.Errorf("unexpected admitted request: %v", cmp.Diff(&expected, admitted))
+			}
+			resp := tt.decode(t, w.Body.Bytes())
+			if resp == nil {
+				t.Fatal("expected a response")
+			}
+			if resp.UID != "uid-1" || !resp.Allowed || !bytes.Equal(resp.Patch, patch) ||
+				resp.PatchType == nil || *resp.PatchType != v1.PatchTypeJSONPatch {
+				t.Errorf("unexpected response %+v", resp)
+			}
+		})
+	}
+}
+
+func ptrTo[T any](v T) *T {
+	return &v
+}
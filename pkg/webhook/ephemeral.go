@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// synthesizeEphemeralPVC returns the PVC the ephemeral volume controller will create for the generic ephemeral volume,
+// which is named <pod>-<volume>. The name is left empty if the pod has no name yet, e.g. it's created with generateName.
+func (a *Admitter) synthesizeEphemeralPVC(ctx context.Context, reqInfo *ReqInfo, volume *corev1.Volume) (*corev1.PersistentVolumeClaim, error) {
+	pod := reqInfo.Pod
+	template := volume.Ephemeral.VolumeClaimTemplate
+
+	name := ephemeralPVCName(pod, volume)
+	if name == "" {
+		klog.V(4).Infof("pod %s has no name yet, the pvc name of ephemeral volume %s can't be predicted", podDisplayName(pod), volume.Name)
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   pod.Namespace,
+			Labels:      template.Labels,
+			Annotations: template.Annotations,
+		},
+		Spec: *template.Spec.DeepCopy(),
+	}
+	if pvc.Spec.StorageClassName == nil {
+		var err error
+		pvc.Spec.StorageClassName, err = a.getDefaultStorageClassName(ctx, reqInfo, fmt.Sprintf("the pvc of ephemeral volume %s", volume.Name))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pvc, nil
+}
+
+// ephemeralPVCName returns the name of the PVC of the generic ephemeral volume, empty if the pod has no name yet.
+func ephemeralPVCName(pod *corev1.Pod, volume *corev1.Volume) string {
+	if pod.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s-%s", pod.Name, volume.Name)
+}
+
+// selectsPVCNames reports if the pvcMatcher of any of the PVCInitializers which may match volumes of volumeType
+// selects PVCs by name, so may match the PVC of an ephemeral volume once the pod is named.
+func selectsPVCNames(pvcInitializers []*sortedPVCInitializer, volumeType v1alpha1.VolumeType) bool {
+	for _, p := range pvcInitializers {
+		pvcMatcher := getPVCMatcher(p.Initializer, p.PVCInitializer.PVCMatcherName)
+		if pvcMatcher == nil || pvcMatcher.PVC == nil {
+			continue
+		}
+		if len(pvcMatcher.VolumeTypes) > 0 && !slices.Contains(pvcMatcher.VolumeTypes, volumeType) {
+			continue
+		}
+		if slices.ContainsFunc(pvcMatcher.PVC.FieldSelector, func(r metav1.FieldSelectorRequirement) bool { return r.Key == v1alpha1.FieldName }) {
+			return true
+		}
+	}
+	return false
+}
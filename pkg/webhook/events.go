@@ -0,0 +1,212 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// Reasons of the events recorded by the webhook.
+const (
+	ReasonInjected         = "InitContainerInjected"
+	ReasonInjectionAudited = "InjectionAudited"
+	ReasonInjectionFailed  = "InjectionFailed"
+)
+
+const (
+	eventComponent = "volume-initializer"
+
+	// podEventsDelay is how long to wait for an admitted pod to be created before recording its events.
+	podEventsDelay = 2 * time.Second
+	// podEventsMaxAttempts is how many times to look for an admitted pod before giving up on its events.
+	podEventsMaxAttempts = 5
+)
+
+// injectionFailure is an error of deciding the init containers of a pod, along with what it's about,
+// so that it can be reported on the objects involved.
+type injectionFailure struct {
+	// ClaimName is the name of the PVC of the volume, which may not exist.
+	ClaimName string
+	// PVC is the PVC of the volume, nil if it can't be read.
+	PVC *corev1.PersistentVolumeClaim
+	// Initializer is the Initializer being evaluated, nil if the evaluation didn't start.
+	Initializer *v1alpha1.Initializer
+	// FailurePolicy is the policy of the PVCInitializer being evaluated which denied the pod, empty if there is none.
+	FailurePolicy v1alpha1.FailurePolicy
+	Err           error
+}
+
+func (f *injectionFailure) Error() string {
+	if f.FailurePolicy != "" {
+		return fmt.Sprintf("%v, failurePolicy of Initializer %s is %s", f.Err, f.Initializer.Name, f.FailurePolicy)
+	}
+	return f.Err.Error()
+}
+
+func (f *injectionFailure) Unwrap() error {
+	return f.Err
+}
+
+// podEvents are the events of an admitted pod, waiting for the pod to be created.
+type podEvents struct {
+	namespace string
+	name      string
+	attempts  int
+	events    []podEvent
+}
+
+type podEvent struct {
+	eventType string
+	reason    string
+	message   string
+}
+
+// eventRecorder records events about injections against the Initializers, PVCs and pods involved.
+// Pods don't exist yet when they are admitted, so their events are recorded once they are created.
+// Only pods which are named on creation get events, pods named from their generateName by the API server
+// can't be told apart. It is safe to call the methods of a nil *eventRecorder, they do nothing.
+type eventRecorder struct {
+	recorder record.EventRecorder
+	client   kubernetes.Interface
+	queue    workqueue.TypedDelayingInterface[*podEvents]
+}
+
+func newEventRecorder(cfg *rest.Config) (*eventRecorder, error) {
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartStructuredLogging(4)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return &eventRecorder{
+		recorder: broadcaster.NewRecorder(scheme, corev1.EventSource{Component: eventComponent}),
+		client:   client,
+		queue: workqueue.NewTypedDelayingQueueWithConfig(workqueue.TypedDelayingQueueConfig[*podEvents]{
+			Name: "pod-events",
+		}),
+	}, nil
+}
+
+// Start records the events of admitted pods once they are created, and blocks until the context is done.
+func (r *eventRecorder) Start(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		r.queue.ShutDown()
+	}()
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for r.processNextPod(ctx) {
+		}
+	}, time.Second)
+}
+
+func (r *eventRecorder) processNextPod(ctx context.Context) bool {
+	item, quit := r.queue.Get()
+	if quit {
+		return false
+	}
+	defer r.queue.Done(item)
+
+	item.attempts++
+	pod, err := r.client.CoreV1().Pods(item.namespace).Get(ctx, item.name, metav1.GetOptions{})
+	if err != nil {
+		if item.attempts < podEventsMaxAttempts {
+			r.queue.AddAfter(item, podEventsDelay)
+			return true
+		}
+		klog.V(4).Infof("give up recording events of pod %s/%s: %v", item.namespace, item.name, err)
+		return true
+	}
+	for _, e := range item.events {
+		r.recorder.Event(pod, e.eventType, e.reason, e.message)
+	}
+	return true
+}
+
+// injected records the injections of init containers into the pod,
+// and the ones Initializers in Audit mode would have done.
+func (r *eventRecorder) injected(pod *corev1.Pod, injections []*injection) {
+	if r == nil || len(injections) == 0 {
+		return
+	}
+	item := &podEvents{namespace: pod.Namespace, name: pod.Name}
+	for _, i := range injections {
+		reason, verb := ReasonInjected, "Injected"
+		if i.Audit {
+			reason, verb = ReasonInjectionAudited, "Would inject"
+		}
+		item.events = append(item.events, podEvent{
+			eventType: corev1.EventTypeNormal,
+			reason:    reason,
+			message: fmt.Sprintf("%s init container %s of Initializer %s for volume %s (pvc %s)",
+				verb, i.ContainerName, i.Initializer, i.VolumeName, i.PVC.Name),
+		})
+		r.recorder.Eventf(i.initializer, corev1.EventTypeNormal, reason,
+			"%s init container %s for volume %s (pvc %s) into pod %s", verb, i.ContainerName, i.VolumeName, i.PVC.Name, podDisplayName(pod))
+		// the PVC of an ephemeral volume doesn't exist yet
+		if i.PVC.UID != "" {
+			r.recorder.Eventf(i.PVC, corev1.EventTypeNormal, reason,
+				"%s init container %s of Initializer %s for volume %s into pod %s", verb, i.ContainerName, i.Initializer, i.VolumeName, podDisplayName(pod))
+		}
+	}
+	if pod.Name != "" {
+		r.queue.AddAfter(item, podEventsDelay)
+	}
+}
+
+// failed records why no init container could be decided for the pod, against the Initializer being evaluated,
+// the PVC and the controller of the pod. The pod itself is denied, so it never exists.
+func (r *eventRecorder) failed(pod *corev1.Pod, err error) {
+	var failure *injectionFailure
+	if r == nil || !errors.As(err, &failure) {
+		return
+	}
+	cause := failure.Error()
+	if failure.Initializer != nil {
+		r.recorder.Eventf(failure.Initializer, corev1.EventTypeWarning, ReasonInjectionFailed,
+			"Failed to evaluate pod %s for pvc %s: %s", podDisplayName(pod), failure.ClaimName, cause)
+	}
+	if failure.PVC != nil && failure.PVC.UID != "" {
+		r.recorder.Eventf(failure.PVC, corev1.EventTypeWarning, ReasonInjectionFailed,
+			"Failed to decide init containers of pod %s: %s", podDisplayName(pod), cause)
+	}
+	if ref := controllerReference(pod); ref != nil {
+		r.recorder.Eventf(ref, corev1.EventTypeWarning, ReasonInjectionFailed,
+			"Failed to decide init containers of pod %s for pvc %s: %s", podDisplayName(pod), failure.ClaimName, cause)
+	}
+}
+
+// controllerReference returns the reference to the controller of the pod, nil if it has none.
+func controllerReference(pod *corev1.Pod) *corev1.ObjectReference {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return nil
+	}
+	return &corev1.ObjectReference{
+		APIVersion: owner.APIVersion,
+		Kind:       owner.Kind,
+		Name:       owner.Name,
+		Namespace:  pod.Namespace,
+		UID:        owner.UID,
+	}
+}
+
+// podDisplayName returns namespace/name of the pod, or namespace/generateName* if it's not named yet.
+func podDisplayName(pod *corev1.Pod) string {
+	if pod.Name != "" {
+		return pod.Namespace + "/" + pod.Name
+	}
+	return pod.Namespace + "/" + pod.GenerateName + "*"
+}
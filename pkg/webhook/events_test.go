@@ -0,0 +1,228 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// immediateQueue adds items right away instead of after a delay, and records the delays.
+type immediateQueue struct {
+	workqueue.TypedInterface[*podEvents]
+	delays []time.Duration
+}
+
+func (q *immediateQueue) AddAfter(item *podEvents, duration time.Duration) {
+	q.delays = append(q.delays, duration)
+	q.Add(item)
+}
+
+func newImmediateQueue() *immediateQueue {
+	return &immediateQueue{TypedInterface: workqueue.NewTyped[*podEvents]()}
+}
+
+func recordedEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	return events
+}
+
+func TestEventRecorderInjected(t *testing.T) {
+	initializer := &v1alpha1.Initializer{ObjectMeta: metav1.ObjectMeta{Name: "chown"}}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default", UID: "uid"}}
+	// the PVC of an ephemeral volume doesn't exist yet
+	ephemeralPVC := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "p-scratch", Namespace: "default"}}
+	injections := []*injection{
+		{
+			PVCInitContainer: &PVCInitContainer{Initializer: "chown", PVC: pvc, initializer: initializer},
+			ContainerName:    "chown-vol-data",
+			VolumeName:       "data",
+		},
+		{
+			PVCInitContainer: &PVCInitContainer{Initializer: "chown", PVC: ephemeralPVC, Audit: true, initializer: initializer},
+			ContainerName:    "chown-vol-scratch",
+			VolumeName:       "scratch",
+		},
+	}
+
+	for _, tc := range []struct {
+		name      string
+		pod       *corev1.Pod
+		podEvents []podEvent
+	}{
+		{
+			name: "named pod",
+			pod:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "default"}},
+			podEvents: []podEvent{
+				{eventType: corev1.EventTypeNormal, reason: ReasonInjected,
+					message: "Injected init container chown-vol-data of Initializer chown for volume data (pvc data)"},
+				{eventType: corev1.EventTypeNormal, reason: ReasonInjectionAudited,
+					message: "Would inject init container chown-vol-scratch of Initializer chown for volume scratch (pvc p-scratch)"},
+			},
+		},
+		// pods named from their generateName can't be found once created
+		{
+			name: "generated name",
+			pod:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{GenerateName: "p-", Namespace: "default"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			queue := newImmediateQueue()
+			r := &eventRecorder{recorder: recorder, queue: queue}
+			r.injected(tc.pod, injections)
+
+			podName := podDisplayName(tc.pod)
+			want := []string{
+				"Normal InitContainerInjected Injected init container chown-vol-data for volume data (pvc data) into pod " + podName,
+				"Normal InitContainerInjected Injected init container chown-vol-data of Initializer chown for volume data into pod " + podName,
+				"Normal InjectionAudited Would inject init container chown-vol-scratch for volume scratch (pvc p-scratch) into pod " + podName,
+			}
+			if diff := cmp.Diff(want, recordedEvents(recorder)); diff != "" {
+				t.Errorf("unexpected events (-want +got):\n%s", diff)
+			}
+
+			if tc.podEvents == nil {
+				if queue.Len() != 0 {
+					t.Errorf("expected no pod events to be queued, got %d", queue.Len())
+				}
+				return
+			}
+			item, _ := queue.Get()
+			if item.namespace != "default" || item.name != "p" {
+				t.Errorf("expected the events of pod default/p to be queued, got %s/%s", item.namespace, item.name)
+			}
+			if diff := cmp.Diff(tc.podEvents, item.events, cmp.AllowUnexported(podEvent{})); diff != "" {
+				t.Errorf("unexpected pod events (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff([]time.Duration{podEventsDelay}, queue.delays); diff != "" {
+				t.Errorf("unexpected delays (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEventRecorderFailed(t *testing.T) {
+	initializer := &v1alpha1.Initializer{ObjectMeta: metav1.ObjectMeta{Name: "chown"}}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default", UID: "uid"}}
+	isController := true
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "web-",
+			Namespace:    "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web", UID: "rs", Controller: &isController},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want []string
+	}{
+		{
+			name: "pvcMatcher failure",
+			err: &injectionFailure{ClaimName: "data", PVC: pvc, Initializer: initializer,
+				FailurePolicy: v1alpha1.FailurePolicyFail, Err: errors.New("unavailable")},
+			want: []string{
+				"Warning InjectionFailed Failed to evaluate pod default/web-* for pvc data: unavailable, failurePolicy of Initializer chown is Fail",
+				"Warning InjectionFailed Failed to decide init containers of pod default/web-*: unavailable, failurePolicy of Initializer chown is Fail",
+				"Warning InjectionFailed Failed to decide init containers of pod default/web-* for pvc data: unavailable, failurePolicy of Initializer chown is Fail",
+			},
+		},
+		// only the controller of the pod hears about a PVC which can't be read
+		{
+			name: "pvc lookup failure",
+			err:  &injectionFailure{ClaimName: "data", Err: errors.New("not found")},
+			want: []string{"Warning InjectionFailed Failed to decide init containers of pod default/web-* for pvc data: not found"},
+		},
+		{
+			name: "other error",
+			err:  errors.New("failed to list Initializers"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &eventRecorder{recorder: recorder}
+			r.failed(pod, tc.err)
+			if diff := cmp.Diff(tc.want, recordedEvents(recorder)); diff != "" {
+				t.Errorf("unexpected events (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEventRecorderProcessNextPod(t *testing.T) {
+	events := []podEvent{{eventType: corev1.EventTypeNormal, reason: ReasonInjected, message: "Injected init container"}}
+
+	t.Run("pod created", func(t *testing.T) {
+		recorder := record.NewFakeRecorder(10)
+		queue := newImmediateQueue()
+		client := fake.NewSimpleClientset(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "default"}})
+		r := &eventRecorder{recorder: recorder, client: client, queue: queue}
+
+		queue.Add(&podEvents{namespace: "default", name: "p", events: events})
+		if !r.processNextPod(context.Background()) {
+			t.Fatal("expected the queue to go on")
+		}
+		if diff := cmp.Diff([]string{"Normal InitContainerInjected Injected init container"}, recordedEvents(recorder)); diff != "" {
+			t.Errorf("unexpected events (-want +got):\n%s", diff)
+		}
+		if queue.Len() != 0 {
+			t.Errorf("expected the pod to be done, got %d items", queue.Len())
+		}
+	})
+
+	t.Run("pod never created", func(t *testing.T) {
+		recorder := record.NewFakeRecorder(10)
+		queue := newImmediateQueue()
+		r := &eventRecorder{recorder: recorder, client: fake.NewSimpleClientset(), queue: queue}
+
+		queue.Add(&podEvents{namespace: "default", name: "p", events: events})
+		for attempt := 1; attempt <= podEventsMaxAttempts; attempt++ {
+			if !r.processNextPod(context.Background()) {
+				t.Fatal("expected the queue to go on")
+			}
+		}
+		// retried after a delay until it gives up
+		if n := len(queue.delays); n != podEventsMaxAttempts-1 {
+			t.Errorf("expected %d retries, got %d", podEventsMaxAttempts-1, n)
+		}
+		if queue.Len() != 0 {
+			t.Errorf("expected the pod to be given up, got %d items", queue.Len())
+		}
+		if events := recordedEvents(recorder); len(events) != 0 {
+			t.Errorf("expected no events, got %v", events)
+		}
+	})
+
+	t.Run("shut down", func(t *testing.T) {
+		queue := newImmediateQueue()
+		r := &eventRecorder{recorder: record.NewFakeRecorder(10), client: fake.NewSimpleClientset(), queue: queue}
+		queue.ShutDown()
+		if r.processNextPod(context.Background()) {
+			t.Error("expected the queue to stop once shut down")
+		}
+	})
+}
+
+func TestEventRecorderNil(t *testing.T) {
+	var r *eventRecorder
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "default"}}
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default", UID: "uid"}}
+	// doesn't panic
+	r.injected(pod, []*injection{{PVCInitContainer: &PVCInitContainer{Initializer: "chown", PVC: pvc}, VolumeName: "data"}})
+	r.failed(pod, &injectionFailure{ClaimName: "data", PVC: pvc, Err: errors.New("unavailable")})
+}
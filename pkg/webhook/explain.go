@@ -0,0 +1,277 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// LabelExplain makes the webhook record the match trace of the pod in the AnnotationMatchTrace annotation when set to "true".
+	LabelExplain = "storage.kubesphere.io/explain"
+	// AnnotationMatchTrace records the match trace of the pod, see MatchTrace.
+	AnnotationMatchTrace = "storage.kubesphere.io/match-trace"
+)
+
+// MatchTrace explains an admission decision, i.e. how each volume of the pod was evaluated against the PVCInitializers.
+type MatchTrace struct {
+	// Skipped is why the pod was not evaluated at all.
+	Skipped string         `json:"skipped,omitempty"`
+	Volumes []*VolumeTrace `json:"volumes"`
+	// Truncated is set if the trace is too large for the AnnotationMatchTrace annotation,
+	// so the evaluations, then the last volumes are left out of it.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// VolumeTrace explains how a volume was evaluated against the PVCInitializers, in evaluation order.
+type VolumeTrace struct {
+	Volume     string              `json:"volume"`
+	VolumeType v1alpha1.VolumeType `json:"volumeType,omitempty"`
+	PVC        string              `json:"pvc,omitempty"`
+	// Skipped is why the volume was not evaluated at all.
+	Skipped     string        `json:"skipped,omitempty"`
+	Evaluations []*Evaluation `json:"evaluations,omitempty"`
+	// Injected are the init containers injected for the volume.
+	Injected []string `json:"injected,omitempty"`
+	// Audited are the init containers Initializers in Audit mode would have injected for the volume.
+	Audited []string `json:"audited,omitempty"`
+}
+
+// EvaluationResult is the result of evaluating a volume against a PVCInitializer.
+type EvaluationResult string
+
+const (
+	// EvaluationMatched means the PVCMatcher matches the volume.
+	EvaluationMatched EvaluationResult = "Matched"
+	// EvaluationNotMatched means the PVCMatcher doesn't match the volume, see RejectedBy and Reason.
+	EvaluationNotMatched EvaluationResult = "NotMatched"
+	// EvaluationDuplicated means the PVCMatcher matches, but the init container already matches the volume.
+	EvaluationDuplicated EvaluationResult = "Duplicated"
+	// EvaluationInvalid means the PVCMatcher or the init container referenced by the PVCInitializer doesn't exist.
+	EvaluationInvalid EvaluationResult = "Invalid"
+	// EvaluationAudited means the PVCMatcher matches, but the Initializer is in Audit mode,
+	// so the init container is not injected and the evaluation goes on.
+	EvaluationAudited EvaluationResult = "Audited"
+	// EvaluationError means the evaluation failed, and so does the admission as the failurePolicy is "Fail".
+	EvaluationError EvaluationResult = "Error"
+	// EvaluationIgnored means the evaluation failed, but the failurePolicy is "Ignore",
+	// so the PVCInitializer is skipped and the evaluation goes on.
+	EvaluationIgnored EvaluationResult = "Ignored"
+)
+
+// Evaluation is the evaluation of a volume against a PVCInitializer.
+type Evaluation struct {
+	Initializer   string           `json:"initializer"`
+	Priority      int32            `json:"priority"`
+	PVCMatcher    string           `json:"pvcMatcher"`
+	InitContainer string           `json:"initContainer"`
+	Result        EvaluationResult `json:"result"`
+	// RejectedBy is the part of the PVCMatcher which rejected the volume,
+	// one of volumeTypes, volumeModes, pvc, pod, storageClass, namespace, workspace.
+	RejectedBy string `json:"rejectedBy,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+func (t *MatchTrace) skip(reason string) {
+	if t == nil {
+		return
+	}
+	t.Skipped = reason
+}
+
+// addVolume starts the trace of a volume, nil is returned if t is nil.
+func (t *MatchTrace) addVolume(volume *corev1.Volume) *VolumeTrace {
+	if t == nil {
+		return nil
+	}
+	v := &VolumeTrace{Volume: volume.Name}
+	t.Volumes = append(t.Volumes, v)
+	return v
+}
+
+func (v *VolumeTrace) setPVC(pvc *corev1.PersistentVolumeClaim, volumeType v1alpha1.VolumeType) {
+	if v == nil {
+		return
+	}
+	v.PVC = pvc.Name
+	v.VolumeType = volumeType
+}
+
+func (v *VolumeTrace) skip(format string, args ...interface{}) {
+	if v == nil {
+		return
+	}
+	v.Skipped = fmt.Sprintf(format, args...)
+}
+
+func (v *VolumeTrace) evaluate(p *sortedPVCInitializer, result EvaluationResult, rejectedBy, reason string) {
+	if v == nil {
+		return
+	}
+	v.Evaluations = append(v.Evaluations, &Evaluation{
+		Initializer:   p.Initializer.Name,
+		Priority:      p.Priority,
+		PVCMatcher:    p.PVCInitializer.PVCMatcherName,
+		InitContainer: p.PVCInitializer.InitContainerName,
+		Result:        result,
+		RejectedBy:    rejectedBy,
+		Reason:        reason,
+	})
+}
+
+func (v *VolumeTrace) inject(container string) {
+	if v == nil {
+		return
+	}
+	v.Injected = append(v.Injected, container)
+}
+
+func (v *VolumeTrace) audit(container string) {
+	if v == nil {
+		return
+	}
+	v.Audited = append(v.Audited, container)
+}
+
+// maxMatchTraceBytes caps the size of the AnnotationMatchTrace annotation, as all the annotations of a pod
+// may not exceed 256KiB. The /debug/explain endpoint and the explain command return the full trace.
+const maxMatchTraceBytes = 32 * 1024
+
+// matchTraceAnnotation returns the AnnotationMatchTrace annotation of the trace, truncated to maxMatchTraceBytes.
+func matchTraceAnnotation(trace *MatchTrace) (string, error) {
+	value, err := json.Marshal(trace)
+	if err != nil {
+		return "", err
+	}
+	if len(value) <= maxMatchTraceBytes {
+		return string(value), nil
+	}
+
+	// the evaluations are left out, the volumes keep what was skipped, injected and audited
+	truncated := &MatchTrace{Skipped: trace.Skipped, Volumes: []*VolumeTrace{}, Truncated: true}
+	if value, err = json.Marshal(truncated); err != nil {
+		return "", err
+	}
+	// then the last volumes which don't fit, each taking its own size and a comma
+	size := len(value)
+	for _, v := range trace.Volumes {
+		volume := *v
+		volume.Evaluations = nil
+		volumeValue, err := json.Marshal(&volume)
+		if err != nil {
+			return "", err
+		}
+		if size += len(volumeValue) + 1; size > maxMatchTraceBytes {
+			break
+		}
+		truncated.Volumes = append(truncated.Volumes, &volume)
+	}
+	if value, err = json.Marshal(truncated); err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// ExplainResult is an admission decision along with the match trace explaining it.
+type ExplainResult struct {
+	Allowed  bool            `json:"allowed"`
+	Message  string          `json:"message,omitempty"`
+	Warnings []string        `json:"warnings,omitempty"`
+	Patch    json.RawMessage `json:"patch,omitempty"`
+	Trace    *MatchTrace     `json:"trace"`
+}
+
+func explainPod(ctx context.Context, admitter AdmitterInterface, pod *corev1.Pod) *ExplainResult {
+	resp, trace := admitter.Explain(ctx, NewReqInfo(pod))
+	result := &ExplainResult{
+		Allowed:  resp.Allowed,
+		Warnings: resp.Warnings,
+		Patch:    resp.Patch,
+		Trace:    trace,
+	}
+	if resp.Result != nil {
+		result.Message = resp.Result.Message
+	}
+	return result
+}
+
+// serveExplainRequest explains the admission of the pod in the request body, which is in YAML or JSON.
+// The namespace of the pod defaults to the "namespace" query parameter, then to "default".
+func (a *Admitter) serveExplainRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	if err != nil {
+		klog.ErrorS(err, "read request body failed")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	obj, _, err := codecs.UniversalDeserializer().Decode(body, nil, &corev1.Pod{})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("request body is not a pod: %v", err), http.StatusBadRequest)
+		return
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		http.Error(w, fmt.Sprintf("request body is not a pod: got %T", obj), http.StatusBadRequest)
+		return
+	}
+	if pod.Namespace == "" {
+		pod.Namespace = r.URL.Query().Get("namespace")
+	}
+	if pod.Namespace == "" {
+		pod.Namespace = metav1.NamespaceDefault
+	}
+
+	respBytes, err := json.Marshal(explainPod(r.Context(), a, pod))
+	if err != nil {
+		klog.ErrorS(err, "failed to marshal explain result")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(respBytes); err != nil {
+		klog.ErrorS(err, "failed to write response")
+	}
+}
+
+// CmdExplain explains the admission of a pod offline, against Initializers and cluster objects read from files.
+var CmdExplain = &cobra.Command{
+	Use:   "explain",
+	Short: "Explain how the webhook would evaluate each volume of a pod against the Initializers",
+	Long: `Explain runs the same decision logic as the webhook against a fake cluster seeded from files,
+and prints the decision along with every PVCInitializer evaluated for each volume of the pod,
+and which part of the PVCMatcher rejected the volume and why. No cluster is needed.`,
+	Args:         cobra.MaximumNArgs(0),
+	SilenceUsage: true,
+	RunE:         explain,
+}
+
+func init() {
+	addRenderInputFlags(CmdExplain)
+}
+
+func explain(cmd *cobra.Command, args []string) error {
+	pod, cli, err := loadRenderInput(renderPodFile, renderInitializersPath, renderObjectsPath)
+	if err != nil {
+		return err
+	}
+	result := explainPod(context.Background(), NewAdmitterWithClient(cli), pod)
+	out, err := yaml.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = cmd.OutOrStdout().Write(out)
+	return err
+}
@@ -0,0 +1,231 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestServeExplainRequest(t *testing.T) {
+	matching := newTestInitializer("chown", "chown")
+	notMatching := newTestInitializer("chown", "chown")
+	notMatching.Spec.PVCMatchers[0].PVC = &v1alpha1.GenericSelector{FieldSelector: []metav1.FieldSelectorRequirement{
+		{Key: v1alpha1.FieldName, Operator: metav1.FieldSelectorOpIn, Values: []string{"logs"}},
+	}}
+	optedOut := newTestNamespace(map[string]string{LabelInitializer: LabelValueDisabled})
+	optedOut.Name = "opted-out"
+
+	for _, tc := range []struct {
+		name        string
+		initializer *v1alpha1.Initializer
+		query       string
+		// want is the trace without the reasons of the evaluations
+		want *MatchTrace
+	}{
+		{
+			name:        "skip",
+			initializer: matching,
+			query:       "?namespace=opted-out",
+			want:        &MatchTrace{Skipped: "namespace opted-out has the label storage.kubesphere.io/initializer=disabled"},
+		},
+		{
+			name:        "match",
+			initializer: matching,
+			want: &MatchTrace{Volumes: []*VolumeTrace{{
+				Volume:      "data",
+				VolumeType:  v1alpha1.VolumeTypePersistentVolumeClaim,
+				PVC:         "data",
+				Evaluations: []*Evaluation{{Initializer: "chown", PVCMatcher: "all", InitContainer: "chown", Result: EvaluationMatched}},
+				Injected:    []string{"chown-vol-data"},
+			}}},
+		},
+		{
+			name:        "no match",
+			initializer: notMatching,
+			want: &MatchTrace{Volumes: []*VolumeTrace{{
+				Volume:     "data",
+				VolumeType: v1alpha1.VolumeTypePersistentVolumeClaim,
+				PVC:        "data",
+				Evaluations: []*Evaluation{{
+					Initializer:   "chown",
+					PVCMatcher:    "all",
+					InitContainer: "chown",
+					Result:        EvaluationNotMatched,
+					RejectedBy:    "pvc",
+				}},
+			}}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := newTestAdmitter(tc.initializer, newTestNamespace(nil), optedOut, newTestPVC("data"))
+			pod := newTestPod("data")
+			// the namespace defaults to the query parameter
+			pod.Namespace = ""
+			body, err := yaml.Marshal(pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			a.serveExplainRequest(w, httptest.NewRequest(http.MethodPost, "/debug/explain"+tc.query, strings.NewReader(string(body))))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+			}
+			result := &ExplainResult{}
+			if err = json.Unmarshal(w.Body.Bytes(), result); err != nil {
+				t.Fatal(err)
+			}
+			if !result.Allowed {
+				t.Errorf("expected the pod to be allowed, got %q", result.Message)
+			}
+			if (len(result.Patch) > 0) != (tc.name == "match") {
+				t.Errorf("unexpected patch %s", result.Patch)
+			}
+			for _, v := range result.Trace.Volumes {
+				for _, e := range v.Evaluations {
+					e.Reason = ""
+				}
+			}
+			if diff := cmp.Diff(tc.want, result.Trace); diff != "" {
+				t.Errorf("unexpected trace (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestServeExplainRequestInvalid(t *testing.T) {
+	a := newTestAdmitter()
+	for _, tc := range []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+	}{
+		{name: "not a post", method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed},
+		{name: "not a pod", method: http.MethodPost, body: "apiVersion: v1\nkind: Namespace\n", wantStatus: http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			a.serveExplainRequest(w, httptest.NewRequest(tc.method, "/debug/explain", strings.NewReader(tc.body)))
+			if w.Code != tc.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tc.wantStatus, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	defer func(pod, initializers, objects string) {
+		renderPodFile, renderInitializersPath, renderObjectsPath = pod, initializers, objects
+	}(renderPodFile, renderInitializersPath, renderObjectsPath)
+
+	testdata := filepath.Join("testdata", "render")
+	renderPodFile = filepath.Join(testdata, "pod.yaml")
+	renderInitializersPath = filepath.Join(testdata, "initializers")
+	renderObjectsPath = filepath.Join(testdata, "objects.yaml")
+	out := &bytes.Buffer{}
+	CmdExplain.SetOut(out)
+	defer CmdExplain.SetOut(nil)
+
+	if err := explain(CmdExplain, nil); err != nil {
+		t.Fatal(err)
+	}
+	result := &ExplainResult{}
+	if err := yaml.Unmarshal(out.Bytes(), result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Allowed {
+		t.Errorf("expected the pod to be allowed, got %q", result.Message)
+	}
+	// the Initializers are evaluated by name, chmod first
+	want := map[string][]EvaluationResult{
+		"data": {EvaluationNotMatched, EvaluationMatched},
+		"logs": {EvaluationMatched},
+	}
+	got := map[string][]EvaluationResult{}
+	for _, v := range result.Trace.Volumes {
+		for _, e := range v.Evaluations {
+			got[v.Volume] = append(got[v.Volume], e.Result)
+		}
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected evaluations (-want +got):\n%s", diff)
+	}
+}
+
+func TestMatchTraceAnnotation(t *testing.T) {
+	// newTrace returns the trace of volumes, each evaluated against the given number of PVCInitializers
+	newTrace := func(volumes, evaluations int) *MatchTrace {
+		trace := &MatchTrace{}
+		for i := 0; i < volumes; i++ {
+			v := &VolumeTrace{Volume: fmt.Sprintf("data-%d", i), Injected: []string{fmt.Sprintf("chown-vol-data-%d", i)}}
+			for j := 0; j < evaluations; j++ {
+				v.Evaluations = append(v.Evaluations, &Evaluation{
+					Initializer:   fmt.Sprintf("initializer-%d", j),
+					PVCMatcher:    "all",
+					InitContainer: "chown",
+					Result:        EvaluationMatched,
+				})
+			}
+			trace.Volumes = append(trace.Volumes, v)
+		}
+		return trace
+	}
+
+	for _, tc := range []struct {
+		name            string
+		volumes         int
+		evaluations     int
+		wantTruncated   bool
+		wantEvaluations bool
+		wantAllVolumes  bool
+	}{
+		{name: "small", volumes: 3, evaluations: 3, wantEvaluations: true, wantAllVolumes: true},
+		{name: "many evaluations", volumes: 50, evaluations: 100, wantTruncated: true, wantAllVolumes: true},
+		{name: "many volumes", volumes: 1000, evaluations: 1, wantTruncated: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			trace := newTrace(tc.volumes, tc.evaluations)
+			value, err := matchTraceAnnotation(trace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(value) > maxMatchTraceBytes {
+				t.Errorf("expected at most %d bytes, got %d", maxMatchTraceBytes, len(value))
+			}
+			got := &MatchTrace{}
+			if err = json.Unmarshal([]byte(value), got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Truncated != tc.wantTruncated {
+				t.Errorf("expected truncated %t, got %t", tc.wantTruncated, got.Truncated)
+			}
+			if len(got.Volumes) == 0 {
+				t.Fatal("expected volumes in the trace")
+			}
+			if hasEvaluations := len(got.Volumes[0].Evaluations) > 0; hasEvaluations != tc.wantEvaluations {
+				t.Errorf("expected evaluations %t, got %t", tc.wantEvaluations, hasEvaluations)
+			}
+			if allVolumes := len(got.Volumes) == tc.volumes; allVolumes != tc.wantAllVolumes {
+				t.Errorf("expected all the volumes %t, got %d of %d", tc.wantAllVolumes, len(got.Volumes), tc.volumes)
+			}
+			if got.Volumes[0].Injected[0] != "chown-vol-data-0" {
+				t.Errorf("expected the injected init containers to be kept, got %v", got.Volumes[0].Injected)
+			}
+			// the trace returned by Explain is not truncated
+			if len(trace.Volumes[0].Evaluations) != tc.evaluations {
+				t.Errorf("expected the trace to be left unchanged, got %d evaluations", len(trace.Volumes[0].Evaluations))
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+const healthCheckTimeout = 5 * time.Second
+
+// healthCheck is a named check of a dependency the webhook needs to serve.
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// healthzHandler reports the webhook is alive as long as it can serve HTTP.
+func healthzHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, "ok")
+}
+
+// readyzHandler runs all checks and reports each of them, in the format of the API server's /readyz?verbose.
+// It responds 503 if any check fails, so that the failing checks are told apart from errors of the handler itself.
+func readyzHandler(checks []healthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		var out bytes.Buffer
+		failed := false
+		for _, c := range checks {
+			if err := c.check(ctx); err != nil {
+				klog.V(2).Infof("readiness check %s failed: %v", c.name, err)
+				fmt.Fprintf(&out, "[-]%s failed: %v\n", c.name, err)
+				failed = true
+				continue
+			}
+			fmt.Fprintf(&out, "[+]%s ok\n", c.name)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if failed {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(&out, "readyz check failed\n")
+		} else {
+			fmt.Fprint(&out, "readyz check passed\n")
+		}
+		w.Write(out.Bytes())
+	}
+}
+
+// shutdownCheck fails once the webhook starts shutting down, so that it's removed from the endpoints
+// while it keeps serving for --shutdown-delay.
+var shutdownCheck = healthCheck{
+	name: "shutdown",
+	check: func(_ context.Context) error {
+		if shuttingDown.Load() {
+			return fmt.Errorf("shutting down")
+		}
+		return nil
+	},
+}
+
+// readinessChecks returns the checks the webhook is ready when all of them pass:
+// the serving certificate is loaded and not expired, the API server is reachable,
+// the informer caches are synced, and the Initializer CRD exists.
+func readinessChecks(cfg *rest.Config, cw *CertWatcher, admitter *Admitter) ([]healthCheck, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return []healthCheck{
+		shutdownCheck,
+		{
+			name: "certificate",
+			check: func(_ context.Context) error {
+				notAfter := cw.NotAfter()
+				if notAfter.IsZero() {
+					return fmt.Errorf("no certificate loaded")
+				}
+				if time.Now().After(notAfter) {
+					return fmt.Errorf("certificate expired at %s", notAfter)
+				}
+				return nil
+			},
+		},
+		{
+			name: "apiserver",
+			check: func(ctx context.Context) error {
+				return discoveryClient.RESTClient().Get().AbsPath("/version").Do(ctx).Error()
+			},
+		},
+		{
+			name: "informer-sync",
+			check: func(_ context.Context) error {
+				if admitter.cache != nil && !admitter.cache.HasSynced() {
+					return fmt.Errorf("informer caches not synced")
+				}
+				return nil
+			},
+		},
+		{
+			name: "crd",
+			check: func(ctx context.Context) error {
+				crd := &apiextensionsv1.CustomResourceDefinition{}
+				return admitter.client.Get(ctx, types.NamespacedName{Name: crdInitializersName}, crd)
+			},
+		},
+	}, nil
+}
+
+// startHealthServer serves /healthz, /readyz and /metrics over plain HTTP on healthPort, so that probes and scrapes
+// don't need TLS, and the HTTPS port only serves clients authenticated by requireClientCert.
+func startHealthServer(ctx context.Context, checks []healthCheck) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", readyzHandler(checks))
+	mux.Handle("/metrics", metricsHandler)
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", healthPort),
+		Handler:           mux,
+		ReadHeaderTimeout: healthCheckTimeout,
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
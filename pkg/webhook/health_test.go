@@ -0,0 +1,89 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReadyz(t *testing.T) {
+	apiserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"major":"1","minor":"31"}`))
+	}))
+	defer apiserver.Close()
+
+	dir := t.TempDir()
+	writeKubeletSecret(t, dir, "1", newTestCertBundle(t))
+	loaded, err := NewCertWatcher(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	crd := &apiextensionsv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: crdInitializersName}}
+
+	defer shuttingDown.Store(false)
+	for _, tc := range []struct {
+		name         string
+		shuttingDown bool
+		noCert       bool
+		notSynced    bool
+		noCRD        bool
+		// wantFailed is the failing check, none if empty
+		wantFailed string
+	}{
+		{name: "ready"},
+		{name: "shutting down", shuttingDown: true, wantFailed: "shutdown"},
+		{name: "no certificate", noCert: true, wantFailed: "certificate"},
+		{name: "informers not synced", notSynced: true, wantFailed: "informer-sync"},
+		{name: "crd missing", noCRD: true, wantFailed: "crd"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			shuttingDown.Store(tc.shuttingDown)
+			cw := loaded
+			if tc.noCert {
+				cw = &CertWatcher{}
+			}
+			var objs []client.Object
+			if !tc.noCRD {
+				objs = append(objs, crd)
+			}
+			a := newTestAdmitter(objs...)
+			a.cache = &cachedReader{}
+			a.cache.synced.Store(!tc.notSynced)
+			checks, err := readinessChecks(&rest.Config{Host: apiserver.URL}, cw, a)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			readyzHandler(checks)(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			wantStatus := http.StatusOK
+			if tc.wantFailed != "" {
+				wantStatus = http.StatusServiceUnavailable
+			}
+			if w.Code != wantStatus {
+				t.Errorf("expected status %d, got %d", wantStatus, w.Code)
+			}
+			for _, c := range checks {
+				want := "[+]" + c.name + " ok\n"
+				if c.name == tc.wantFailed {
+					want = "[-]" + c.name + " failed: "
+				}
+				if !strings.Contains(w.Body.String(), want) {
+					t.Errorf("expected %q in the response, got:\n%s", want, w.Body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package webhook
+
+import (
+	"net/http"
+
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+)
+
+func serveInitializerRequest(w http.ResponseWriter, r *http.Request) {
+	server(w, r, newDelegateToV1AdmitHandler(ValidateInitializer))
+}
+
+// ValidateInitializer rejects Initializers with unresolvable references, duplicate names or
+// unsupported selectors, so that mistakes are caught when they are applied rather than when pods are created.
+func ValidateInitializer(ar admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	if ar.Request.Operation != admissionv1.Create && ar.Request.Operation != admissionv1.Update {
+		return toV1AdmissionResponseWithPatch(nil)
+	}
+
+	deserializer := codecs.UniversalDeserializer()
+	initializer := &v1alpha1.Initializer{}
+	_, _, err := deserializer.Decode(ar.Request.Object.Raw, nil, initializer)
+	if err != nil {
+		klog.ErrorS(err, "failed to decode raw object")
+		return toV1AdmissionResponse(err)
+	}
+
+	if errs := v1alpha1.ValidateInitializer(initializer); len(errs) > 0 {
+		err = errors.NewInvalid(v1alpha1.Kind("Initializer"), initializer.Name, errs)
+		klog.Infof("rejecting initializer %s: %v", initializer.Name, err)
+		return toV1AdmissionResponse(err)
+	}
+	return toV1AdmissionResponseWithPatch(nil)
+}
@@ -0,0 +1,125 @@
+package webhook
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const metricsNamespace = "volume_initializer"
+
+// Outcomes of admission requests.
+const (
+	outcomeAllowedWithPatch = "allowed_with_patch"
+	outcomeAllowedNoOp      = "allowed_no_op"
+	outcomeDenied           = "denied"
+	outcomeDecodeError      = "decode_error"
+	// outcomeAllowedOverloaded means the request is allowed without being processed, see --max-concurrent-requests.
+	outcomeAllowedOverloaded = "allowed_overloaded"
+	// outcomeRejectedOverloaded means the request is rejected with 429 without being processed, see --max-concurrent-requests.
+	outcomeRejectedOverloaded = "rejected_overloaded"
+)
+
+// Results of cache lookups.
+const (
+	// cacheHit means the object is read from the informer cache.
+	cacheHit = "hit"
+	// cacheMiss means the object is not found in the informer cache. PVCs are read from the API server then.
+	cacheMiss = "miss"
+	// cacheNotSynced means the informer cache is not synced yet, and the object is read from the API server.
+	cacheNotSynced = "not_synced"
+	// cacheError means the informer cache failed to read the object.
+	cacheError = "error"
+)
+
+// Sources of lookups.
+const (
+	sourceCache     = "cache"
+	sourceAPIServer = "api_server"
+)
+
+var (
+	admissionRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "admission_requests_total",
+		Help:      "Number of admission requests by webhook path and outcome.",
+	}, []string{"webhook", "outcome"})
+
+	admissionRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "admission_request_duration_seconds",
+		Help:      "Latency of admission requests by webhook path and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"webhook", "outcome"})
+
+	injectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "injections_total",
+		Help:      "Number of injected init containers by Initializer and PVCMatcher.",
+	}, []string{"initializer", "pvc_matcher"})
+
+	auditedInjectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "audited_injections_total",
+		Help:      "Number of init containers Initializers in Audit mode would have injected by Initializer and PVCMatcher.",
+	}, []string{"initializer", "pvc_matcher"})
+
+	lookupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "lookup_duration_seconds",
+		Help:      "Latency of object lookups by kind, operation and source, either cache or api_server.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 9),
+	}, []string{"kind", "operation", "source"})
+
+	cacheLookupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_lookups_total",
+		Help:      "Number of object lookups by kind and result, one of hit, miss, not_synced and error.",
+	}, []string{"kind", "result"})
+
+	certificateExpiryTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "certificate_expiry_timestamp_seconds",
+		Help:      "Expiry time of the serving certificate in seconds since epoch.",
+	})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		admissionRequestsTotal,
+		admissionRequestDuration,
+		injectionsTotal,
+		auditedInjectionsTotal,
+		lookupDuration,
+		cacheLookupsTotal,
+		certificateExpiryTimestamp,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// metricsHandler serves the metrics of the webhook, along with the client-go and workqueue metrics
+// controller-runtime registers.
+var metricsHandler = promhttp.HandlerFor(ctrlmetrics.Registry, promhttp.HandlerOpts{})
+
+func observeAdmission(webhook, outcome string, start time.Time) {
+	admissionRequestsTotal.WithLabelValues(webhook, outcome).Inc()
+	admissionRequestDuration.WithLabelValues(webhook, outcome).Observe(time.Since(start).Seconds())
+}
+
+func observeLookup(obj runtime.Object, operation, source, cacheResult string, start time.Time) {
+	kind := "unknown"
+	if gvk, err := apiutil.GVKForObject(obj, scheme); err == nil {
+		kind = strings.TrimSuffix(gvk.Kind, "List")
+	}
+	lookupDuration.WithLabelValues(kind, operation, source).Observe(time.Since(start).Seconds())
+	if cacheResult != "" {
+		cacheLookupsTotal.WithLabelValues(kind, cacheResult).Inc()
+	}
+}
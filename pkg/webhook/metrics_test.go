@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAdmissionMetrics(t *testing.T) {
+	admissionRequestsTotal.Reset()
+	admissionRequestDuration.Reset()
+
+	review := admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{UID: "uid"}}
+	review.SetGroupVersionKind(admissionv1.SchemeGroupVersion.WithKind("AdmissionReview"))
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		body []byte
+		resp *admissionv1.AdmissionResponse
+	}{
+		{name: "allowed with patch", body: body, resp: &admissionv1.AdmissionResponse{Allowed: true, Patch: []byte("[]")}},
+		{name: "allowed no-op", body: body, resp: &admissionv1.AdmissionResponse{Allowed: true}},
+		{name: "denied", body: body, resp: &admissionv1.AdmissionResponse{Result: &metav1.Status{Message: "denied"}}},
+		{name: "decode error", body: []byte("{")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := newDelegateToV1AdmitHandler(func(admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+				return tc.resp
+			})
+			r := httptest.NewRequest(http.MethodPost, "/pods", bytes.NewReader(tc.body))
+			r.Header.Set("Content-Type", "application/json")
+			server(httptest.NewRecorder(), r, handler)
+		})
+	}
+
+	want := `
+# HELP volume_initializer_admission_requests_total Number of admission requests by webhook path and outcome.
+# TYPE volume_initializer_admission_requests_total counter
+volume_initializer_admission_requests_total{outcome="allowed_no_op",webhook="/pods"} 1
+volume_initializer_admission_requests_total{outcome="allowed_with_patch",webhook="/pods"} 1
+volume_initializer_admission_requests_total{outcome="decode_error",webhook="/pods"} 1
+volume_initializer_admission_requests_total{outcome="denied",webhook="/pods"} 1
+`
+	if err = testutil.CollectAndCompare(admissionRequestsTotal, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(admissionRequestDuration); n != 4 {
+		t.Errorf("expected the latency of 4 outcomes, got %d", n)
+	}
+}
+
+func TestInjectionMetrics(t *testing.T) {
+	audit := newTestInitializer("audit", "audit")
+	audit.Spec.Mode = v1alpha1.InitializerModeAudit
+	a := newTestAdmitter(newTestInitializer("chown", "chown"), audit, newTestNamespace(nil), newTestPVC("data"))
+	injected := injectionsTotal.WithLabelValues("chown", "all")
+	audited := auditedInjectionsTotal.WithLabelValues("audit", "all")
+	injectedBefore, auditedBefore := testutil.ToFloat64(injected), testutil.ToFloat64(audited)
+
+	if resp := a.Decide(context.Background(), NewReqInfo(newTestPod("data"))); len(resp.Patch) == 0 {
+		t.Fatalf("expected the pod to be patched, got %+v", resp)
+	}
+	if got := testutil.ToFloat64(injected) - injectedBefore; got != 1 {
+		t.Errorf("expected 1 injection of chown, got %v", got)
+	}
+	if got := testutil.ToFloat64(audited) - auditedBefore; got != 1 {
+		t.Errorf("expected 1 audited injection of audit, got %v", got)
+	}
+}
+
+func TestLookupMetrics(t *testing.T) {
+	lookupDuration.Reset()
+	cacheLookupsTotal.Reset()
+
+	observeLookup(&corev1.PersistentVolumeClaim{}, "get", sourceCache, cacheHit, time.Now())
+	observeLookup(&corev1.PersistentVolumeClaim{}, "get", sourceAPIServer, cacheMiss, time.Now())
+	observeLookup(&corev1.NamespaceList{}, "list", sourceAPIServer, "", time.Now())
+
+	want := `
+# HELP volume_initializer_cache_lookups_total Number of object lookups by kind and result, one of hit, miss, not_synced and error.
+# TYPE volume_initializer_cache_lookups_total counter
+volume_initializer_cache_lookups_total{kind="PersistentVolumeClaim",result="hit"} 1
+volume_initializer_cache_lookups_total{kind="PersistentVolumeClaim",result="miss"} 1
+`
+	if err := testutil.CollectAndCompare(cacheLookupsTotal, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(lookupDuration); n != 3 {
+		t.Errorf("expected the latency of 3 lookups, got %d", n)
+	}
+	// the kind of a list is the kind of its items
+	if !lookupDuration.DeleteLabelValues("Namespace", "list", sourceAPIServer) {
+		t.Error("expected the latency of the list of Namespaces")
+	}
+}
+
+func TestCertificateExpiryMetric(t *testing.T) {
+	dir := t.TempDir()
+	bundle := newTestCertBundle(t)
+	writeKubeletSecret(t, dir, "1", bundle)
+	if _, err := NewCertWatcher(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := testutil.ToFloat64(certificateExpiryTimestamp), float64(bundle.cert.NotAfter.Unix()); got != want {
+		t.Errorf("expected expiry %v, got %v", want, got)
+	}
+}
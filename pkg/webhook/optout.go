@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// LabelInitializer opts a Namespace, pod or PVC out of the Initializers when set to LabelValueDisabled,
+	// and opts a Namespace in when set to LabelValueEnabled, see NamespacePolicyOptIn.
+	LabelInitializer = "storage.kubesphere.io/initializer"
+	// LabelValueDisabled is the value of LabelInitializer which opts out.
+	LabelValueDisabled = "disabled"
+	// LabelValueEnabled is the value of LabelInitializer which opts in.
+	LabelValueEnabled = "enabled"
+
+	// AnnotationSkipVolumeSuffix opts a volume of a pod out of the Initializers when the pod has the annotation
+	// <volume>.volume.storage.kubesphere.io/skip set to "true".
+	AnnotationSkipVolumeSuffix = ".volume.storage.kubesphere.io/skip"
+)
+
+// NamespacePolicy decides which namespaces the pods are evaluated in.
+type NamespacePolicy string
+
+const (
+	// NamespacePolicyOptOut evaluates the pods of every namespace, except the ones labeled to opt out.
+	NamespacePolicyOptOut NamespacePolicy = "OptOut"
+	// NamespacePolicyOptIn only evaluates the pods of the namespaces labeled to opt in.
+	NamespacePolicyOptIn NamespacePolicy = "OptIn"
+)
+
+// podOptedOut returns why the pod is not evaluated at all, an empty reason means it is.
+// The pod opts out with its own label, or with the one of its namespace, which must opt in with NamespacePolicyOptIn.
+// A namespace which can't be read neither opts out nor in, the pod is evaluated with a warning,
+// so that whether it's denied is up to the failurePolicy of the pvcInitializers, which read the namespace too.
+func (a *Admitter) podOptedOut(ctx context.Context, reqInfo *ReqInfo) string {
+	pod := reqInfo.Pod
+	if pod.Labels[LabelInitializer] == LabelValueDisabled {
+		return fmt.Sprintf("pod has the label %s=%s", LabelInitializer, LabelValueDisabled)
+	}
+
+	ns := &corev1.Namespace{}
+	if err := a.client.Get(ctx, types.NamespacedName{Name: pod.Namespace}, ns); err != nil {
+		reqInfo.warn("failed to get namespace %s, the pod is evaluated whatever its label %s: %v", pod.Namespace, LabelInitializer, err)
+		return ""
+	}
+	switch value := ns.Labels[LabelInitializer]; {
+	case value == LabelValueDisabled:
+		return fmt.Sprintf("namespace %s has the label %s=%s", ns.Name, LabelInitializer, LabelValueDisabled)
+	case value != LabelValueEnabled && a.namespacePolicy == NamespacePolicyOptIn:
+		return fmt.Sprintf("namespace %s doesn't have the label %s=%s, and the namespace policy is %s",
+			ns.Name, LabelInitializer, LabelValueEnabled, NamespacePolicyOptIn)
+	}
+	return ""
+}
+
+// volumeOptedOut returns whether the volume of the pod is opted out with the AnnotationSkipVolumeSuffix annotation of the pod.
+func volumeOptedOut(pod *corev1.Pod, volume *corev1.Volume) bool {
+	return pod.Annotations[volume.Name+AnnotationSkipVolumeSuffix] == "true"
+}
+
+// pvcOptedOut returns whether the PVC is opted out with its label. The PVCs of ephemeral volumes
+// get the labels of their volumeClaimTemplate.
+func pvcOptedOut(pvc *corev1.PersistentVolumeClaim) bool {
+	return pvc.Labels[LabelInitializer] == LabelValueDisabled
+}
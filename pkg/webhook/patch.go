@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// patchOperation is a JSON patch (RFC 6902) operation.
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// injectedInitContainer is an init container to inject, along with where to insert it.
+type injectedInitContainer struct {
+	Container *corev1.Container
+	Position  *v1alpha1.InitContainerPosition
+}
+
+// initContainersPatchOps returns the operations which insert the injected init containers
+// among the pod's own init containers, keeping the latter untouched.
+func initContainersPatchOps(pod *corev1.Pod, injected []*injectedInitContainer) []patchOperation {
+	merged, isInjected := mergeInitContainers(pod.Spec.InitContainers, injected)
+	if len(pod.Spec.InitContainers) == 0 {
+		return []patchOperation{
+			{Op: "add", Path: "/spec/initContainers", Value: merged},
+		}
+	}
+	// Adding the injected init containers by ascending index results in the merged init containers,
+	// as the ones before each of them are already in place.
+	var ops []patchOperation
+	for i := range merged {
+		if isInjected[i] {
+			ops = append(ops, patchOperation{
+				Op:    "add",
+				Path:  fmt.Sprintf("/spec/initContainers/%d", i),
+				Value: merged[i],
+			})
+		}
+	}
+	return ops
+}
+
+// mergeInitContainers inserts the injected init containers among the existing ones according to their positions,
+// injected init containers with the same position keep their order. An init container to be inserted before or
+// after a non-existent init container is prepended.
+// It returns the merged init containers and whether each of them is injected.
+func mergeInitContainers(existing []corev1.Container, injected []*injectedInitContainer) ([]corev1.Container, []bool) {
+	merged := slices.Clone(existing)
+	isInjected := make([]bool, len(existing))
+
+	indexOf := func(name string) int {
+		for i := range merged {
+			if !isInjected[i] && merged[i].Name == name {
+				return i
+			}
+		}
+		return -1
+	}
+	insert := func(i int, c *corev1.Container) {
+		merged = slices.Insert(merged, i, *c)
+		isInjected = slices.Insert(isInjected, i, true)
+	}
+
+	prepended := 0
+	insertedAfter := map[string]int{}
+	for _, c := range injected {
+		positionType := v1alpha1.PositionPrepend
+		if c.Position != nil {
+			positionType = c.Position.Type
+		}
+		switch positionType {
+		case v1alpha1.PositionBefore, v1alpha1.PositionAfter:
+			i := indexOf(c.Position.ContainerName)
+			if i < 0 {
+				klog.Warningf("initContainer %s to insert %s not found, prepend %s",
+					c.Position.ContainerName, strings.ToLower(string(positionType)), c.Container.Name)
+				insert(prepended, c.Container)
+				prepended++
+				continue
+			}
+			if positionType == v1alpha1.PositionAfter {
+				i += 1 + insertedAfter[c.Position.ContainerName]
+				insertedAfter[c.Position.ContainerName]++
+			}
+			insert(i, c.Container)
+		case v1alpha1.PositionAppend:
+			insert(len(merged), c.Container)
+		default:
+			insert(prepended, c.Container)
+			prepended++
+		}
+	}
+	return merged, isInjected
+}
+
+// annotationsPatchOps returns the operations which set the annotations on the pod,
+// keeping the annotations the pod already has.
+func annotationsPatchOps(pod *corev1.Pod, annotations map[string]string) []patchOperation {
+	if len(annotations) == 0 {
+		return nil
+	}
+	if pod.Annotations == nil {
+		return []patchOperation{
+			{Op: "add", Path: "/metadata/annotations", Value: annotations},
+		}
+	}
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	ops := make([]patchOperation, 0, len(annotations))
+	for _, k := range keys {
+		ops = append(ops, patchOperation{
+			Op:    "add",
+			Path:  "/metadata/annotations/" + escapeJSONPointer(k),
+			Value: annotations[k],
+		})
+	}
+	return ops
+}
+
+// escapeJSONPointer escapes a reference token of a JSON pointer (RFC 6901).
+func escapeJSONPointer(s string) string {
+	s = strings.ReplaceAll(s, "~", "~0")
+	return strings.ReplaceAll(s, "/", "~1")
+}
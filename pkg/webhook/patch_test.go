@@ -0,0 +1,140 @@
+package webhook
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestInitContainersPatchOps(t *testing.T) {
+	inject := func(name string, positionType v1alpha1.InitContainerPositionType, containerName string) *injectedInitContainer {
+		c := &injectedInitContainer{Container: &corev1.Container{Name: name}}
+		if positionType != "" {
+			c.Position = &v1alpha1.InitContainerPosition{Type: positionType, ContainerName: containerName}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		existing []string
+		injected []*injectedInitContainer
+		expected []string
+	}{
+		{
+			name:     "no existing init containers",
+			injected: []*injectedInitContainer{inject("a", "", ""), inject("b", v1alpha1.PositionAppend, "")},
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "no existing init containers with before and after",
+			injected: []*injectedInitContainer{inject("a", v1alpha1.PositionBefore, "x"), inject("b", v1alpha1.PositionAfter, "x")},
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "one existing init container, prepend by default",
+			existing: []string{"istio-init"},
+			injected: []*injectedInitContainer{inject("a", "", ""), inject("b", "", "")},
+			expected: []string{"a", "b", "istio-init"},
+		},
+		{
+			name:     "one existing init container, append",
+			existing: []string{"istio-init"},
+			injected: []*injectedInitContainer{inject("a", v1alpha1.PositionAppend, ""), inject("b", v1alpha1.PositionAppend, "")},
+			expected: []string{"istio-init", "a", "b"},
+		},
+		{
+			name:     "one existing init container, before and after",
+			existing: []string{"istio-init"},
+			injected: []*injectedInitContainer{inject("a", v1alpha1.PositionAfter, "istio-init"), inject("b", v1alpha1.PositionBefore, "istio-init")},
+			expected: []string{"b", "istio-init", "a"},
+		},
+		{
+			name:     "one existing init container, reference not found",
+			existing: []string{"istio-init"},
+			injected: []*injectedInitContainer{inject("a", v1alpha1.PositionAfter, "migrate")},
+			expected: []string{"a", "istio-init"},
+		},
+		{
+			name:     "many existing init containers",
+			existing: []string{"istio-init", "migrate", "seed"},
+			injected: []*injectedInitContainer{
+				inject("a", v1alpha1.PositionAfter, "istio-init"),
+				inject("b", v1alpha1.PositionBefore, "migrate"),
+				inject("c", v1alpha1.PositionAfter, "istio-init"),
+				inject("d", v1alpha1.PositionAppend, ""),
+				inject("e", v1alpha1.PositionPrepend, ""),
+				inject("f", v1alpha1.PositionAfter, "seed"),
+			},
+			expected: []string{"e", "istio-init", "a", "c", "b", "migrate", "seed", "f", "d"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{}
+			for _, name := range tt.existing {
+				pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{Name: name})
+			}
+
+			patched := applyPatchOps(t, pod, initContainersPatchOps(pod, tt.injected))
+
+			var names []string
+			for _, c := range patched.Spec.InitContainers {
+				names = append(names, c.Name)
+			}
+			if !slices.Equal(names, tt.expected) {
+				t.Errorf("expected init containers %v, got %v", tt.expected, names)
+			}
+		})
+	}
+}
+
+func TestAnnotationsPatchOps(t *testing.T) {
+	annotations := map[string]string{"storage.kubesphere.io/a": "1", "b": "2"}
+
+	for _, existing := range []map[string]string{nil, {"b": "0", "c": "3"}} {
+		pod := &corev1.Pod{}
+		pod.Annotations = existing
+
+		patched := applyPatchOps(t, pod, annotationsPatchOps(pod, annotations))
+
+		for k, v := range annotations {
+			if patched.Annotations[k] != v {
+				t.Errorf("expected annotation %s=%s, got %q", k, v, patched.Annotations[k])
+			}
+		}
+		if existing != nil && patched.Annotations["c"] != "3" {
+			t.Errorf("expected existing annotation c to be kept, got %v", patched.Annotations)
+		}
+	}
+}
+
+func applyPatchOps(t *testing.T, pod *corev1.Pod, ops []patchOperation) *corev1.Pod {
+	t.Helper()
+	podBytes, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patchBytes, err := json.Marshal(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, err := jsonpatch.DecodePatch(patchBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patchedBytes, err := patch.Apply(podBytes)
+	if err != nil {
+		t.Fatalf("failed to apply patch %s: %v", patchBytes, err)
+	}
+	patched := &corev1.Pod{}
+	if err = json.Unmarshal(patchedBytes, patched); err != nil {
+		t.Fatal(err)
+	}
+	return patched
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"maps"
 	"net/http"
 	"path"
 	"slices"
+	"strings"
 
 	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
 	admissionv1 "k8s.io/api/admission/v1"
@@ -14,16 +17,23 @@ import (
 	v1 "k8s.io/api/storage/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 	tenantv1alpha1 "kubesphere.io/api/tenant/v1alpha1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
 type ReqInfo struct {
 	Pod *corev1.Pod
+	// DryRun is set if the request won't be persisted, so the decision must not have side effects.
+	DryRun bool
+
+	// warnings are returned in the admission response, see warn.
+	warnings []string
 }
 
 func NewReqInfo(pod *corev1.Pod) *ReqInfo {
@@ -32,6 +42,24 @@ func NewReqInfo(pod *corev1.Pod) *ReqInfo {
 	}
 }
 
+// warn logs the warning, and returns it in the admission response so that it's displayed to the user.
+// It's for volumes which match but can't be initialized, and for lookups which degrade the decision.
+func (r *ReqInfo) warn(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	klog.Warning(msg)
+	if !slices.Contains(r.warnings, msg) {
+		r.warnings = append(r.warnings, msg)
+	}
+}
+
+// withWarnings prepends the warnings of the request to the ones of the response.
+func (r *ReqInfo) withWarnings(resp *admissionv1.AdmissionResponse) *admissionv1.AdmissionResponse {
+	if r != nil && len(r.warnings) > 0 {
+		resp.Warnings = append(slices.Clone(r.warnings), resp.Warnings...)
+	}
+	return resp
+}
+
 func toV1AdmissionResponseWithPatch(patch []byte) *admissionv1.AdmissionResponse {
 	pt := admissionv1.PatchTypeJSONPatch
 	resp := &admissionv1.AdmissionResponse{
@@ -48,39 +76,71 @@ func toV1AdmissionResponseWithPatch(patch []byte) *admissionv1.AdmissionResponse
 type AdmitterInterface interface {
 	Admit(ar admissionv1.AdmissionReview) *admissionv1.AdmissionResponse
 	Decide(ctx context.Context, reqInfo *ReqInfo) *admissionv1.AdmissionResponse
+	Explain(ctx context.Context, reqInfo *ReqInfo) (*admissionv1.AdmissionResponse, *MatchTrace)
 }
 
 type Admitter struct {
-	client client.Client
+	client client.Reader
+
+	// cache is the informer cache client reads from, nil if client is not cached.
+	cache *cachedReader
+
+	// missingPVCPolicy decides what to do with volumes whose PVC neither exists nor can be synthesized.
+	missingPVCPolicy MissingPVCPolicy
+
+	// namespacePolicy decides which namespaces the pods are evaluated in.
+	namespacePolicy NamespacePolicy
+
+	// events records events about injections and failures, may be nil.
+	events *eventRecorder
 }
 
 var _ AdmitterInterface = (*Admitter)(nil)
 
-func NewAdmitter() (*Admitter, error) {
-	cfg, err := config.GetConfig()
+func NewAdmitter(cfg *rest.Config) (*Admitter, error) {
+	cachedReader, err := newCachedReader(cfg)
 	if err != nil {
 		return nil, err
 	}
-	cli, err := client.New(cfg, client.Options{
-		Scheme: scheme,
-	})
+	events, err := newEventRecorder(cfg)
 	if err != nil {
 		return nil, err
 	}
 	a := &Admitter{
-		client: cli,
+		client:           cachedReader,
+		cache:            cachedReader,
+		missingPVCPolicy: MissingPVCPolicyDeny,
+		namespacePolicy:  NamespacePolicyOptOut,
+		events:           events,
 	}
 	return a, nil
 }
 
-func NewAdmitterWithClient(client client.Client) AdmitterInterface {
+func NewAdmitterWithClient(client client.Reader) AdmitterInterface {
 	return &Admitter{
-		client: client,
+		client:           client,
+		missingPVCPolicy: MissingPVCPolicyDeny,
+		namespacePolicy:  NamespacePolicyOptOut,
 	}
 }
 
+// Start starts the informer cache and the event recorder of the admitter and blocks until the context is done.
+func (a *Admitter) Start(ctx context.Context) error {
+	if a.events != nil {
+		go a.events.Start(ctx)
+	}
+	if a.cache == nil {
+		<-ctx.Done()
+		return nil
+	}
+	return a.cache.Start(ctx)
+}
+
 func (a *Admitter) serverPVCRequest(w http.ResponseWriter, r *http.Request) {
-	server(w, r, newDelegateToV1AdmitHandler(a.Admit))
+	// pods are better created without init containers than not at all
+	handler := newDelegateToV1AdmitHandler(a.Admit)
+	handler.failOpen = true
+	server(w, r, handler)
 }
 
 func (a *Admitter) Admit(ar admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
@@ -107,13 +167,10 @@ func (a *Admitter) Admit(ar admissionv1.AdmissionReview) *admissionv1.AdmissionR
 	}
 
 	crdInitializers := &apiextensionsv1.CustomResourceDefinition{}
-	crdInitializersName := types.NamespacedName{
-		Name: "initializers.storage.kubesphere.io",
-	}
-	err = a.client.Get(ctx, crdInitializersName, crdInitializers)
+	err = a.client.Get(ctx, types.NamespacedName{Name: crdInitializersName}, crdInitializers)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			klog.Warningf("crd %s not found, skip processing", crdInitializersName.Name)
+			klog.Warningf("crd %s not found, skip processing", crdInitializersName)
 			return toV1AdmissionResponseWithPatch(nil)
 		}
 		return toV1AdmissionResponse(err)
@@ -123,119 +180,436 @@ func (a *Admitter) Admit(ar admissionv1.AdmissionReview) *admissionv1.AdmissionR
 	pod.Namespace = namespace
 
 	reqInfo := NewReqInfo(pod)
+	reqInfo.DryRun = ar.Request.DryRun != nil && *ar.Request.DryRun
 
 	klog.Infof("request info: %+v", reqInfo)
 	return a.Decide(context.Background(), reqInfo)
 }
 
 const (
-	EnvVarPVC1MountPath = "PVC_1_MOUNT_PATH"
-	EnvVarPVC1UID       = "PVC_1_UID"
-	EnvVarPVC1GID       = "PVC_1_GID"
+	EnvVarPVC1MountPath  = "PVC_1_MOUNT_PATH"
+	EnvVarPVC1DevicePath = "PVC_1_DEVICE_PATH"
+	EnvVarPVC1UID        = "PVC_1_UID"
+	EnvVarPVC1GID        = "PVC_1_GID"
 )
 
 func (a *Admitter) Decide(ctx context.Context, reqInfo *ReqInfo) *admissionv1.AdmissionResponse {
-	var err error
+	var trace *MatchTrace
+	if reqInfo != nil && reqInfo.Pod != nil && reqInfo.Pod.Labels[LabelExplain] == "true" {
+		trace = &MatchTrace{}
+	}
+	resp, injections, err := a.decide(ctx, reqInfo, trace)
+	resp = reqInfo.withWarnings(resp)
+	if reqInfo != nil && reqInfo.DryRun {
+		// no events nor injection records for requests which won't be persisted
+		return resp
+	}
+	if err != nil {
+		a.events.failed(reqInfo.Pod, err)
+		return resp
+	}
+	if len(injections) > 0 {
+		recordInjections(injections)
+		a.events.injected(reqInfo.Pod, injections)
+	}
+	return resp
+}
 
+// Explain decides like Decide, and returns the match trace explaining the decision.
+func (a *Admitter) Explain(ctx context.Context, reqInfo *ReqInfo) (*admissionv1.AdmissionResponse, *MatchTrace) {
+	trace := &MatchTrace{}
+	resp, _, _ := a.decide(ctx, reqInfo, trace)
+	return reqInfo.withWarnings(resp), trace
+}
+
+// recordInjections counts the injected init containers in the metrics, and the ones of Initializers in Audit mode apart.
+func recordInjections(injections []*injection) {
+	for _, c := range injections {
+		if c.Audit {
+			auditedInjectionsTotal.WithLabelValues(c.Initializer, c.PVCMatcher).Inc()
+			continue
+		}
+		injectionsTotal.WithLabelValues(c.Initializer, c.PVCMatcher).Inc()
+	}
+}
+
+// injection is an init container injected into a pod for a volume, or which would have been if Audit is set.
+type injection struct {
+	*PVCInitContainer
+	// ContainerName is the name of the injected init container, suffixed with the volume name.
+	ContainerName string
+	VolumeName    string
+}
+
+const (
+	// AnnotationInitializedVolumes records, for each volume of the pod, the init containers injected for it in evaluation order,
+	// see InitializedVolume. The volumes it records are not evaluated again, so that reinvocations of the webhook don't change the pod.
+	AnnotationInitializedVolumes = "storage.kubesphere.io/initialized-volumes"
+	// AnnotationAuditedVolumes records, in the same format as AnnotationInitializedVolumes, the init containers
+	// Initializers in Audit mode would have injected.
+	AnnotationAuditedVolumes = "storage.kubesphere.io/audited-volumes"
+)
+
+// InitializedVolume is an init container injected for a volume in the AnnotationInitializedVolumes annotation,
+// or which an Initializer in Audit mode would have injected in the AnnotationAuditedVolumes annotation.
+type InitializedVolume struct {
+	// Container is the name of the injected init container.
+	Container   string `json:"container"`
+	Initializer string `json:"initializer"`
+	// Generation is the generation of the Initializer when the init container was injected.
+	Generation int64  `json:"generation"`
+	PVCMatcher string `json:"pvcMatcher"`
+	// InitContainer is the name of the init container in the Initializer.
+	InitContainer string `json:"initContainer"`
+	// Priority is the priority the PVCInitializer was evaluated with.
+	Priority int32 `json:"priority"`
+}
+
+// recordedVolumes returns the volumes recorded in the annotation of the pod, either AnnotationInitializedVolumes
+// or AnnotationAuditedVolumes, by a previous admission of the pod, e.g. when the webhook is reinvoked.
+func recordedVolumes(pod *corev1.Pod, annotation string) (map[string][]InitializedVolume, error) {
+	return parseVolumes(pod.Annotations, annotation)
+}
+
+func parseVolumes(annotations map[string]string, annotation string) (map[string][]InitializedVolume, error) {
+	value, ok := annotations[annotation]
+	if !ok {
+		return nil, nil
+	}
+	var volumes map[string][]InitializedVolume
+	if err := json.Unmarshal([]byte(value), &volumes); err != nil {
+		return nil, err
+	}
+	return volumes, nil
+}
+
+// injectedInitializers indexes pods by the Initializers whose init containers were injected into them,
+// according to their AnnotationInitializedVolumes annotation. The status controller counts injectedPods from it.
+func injectedInitializers(obj interface{}) ([]string, error) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := parseVolumes(m.GetAnnotations(), AnnotationInitializedVolumes)
+	if err != nil {
+		// the index function must not fail, the pod is just not counted
+		klog.V(4).Infof("invalid %s annotation of pod %s/%s: %v", AnnotationInitializedVolumes, m.GetNamespace(), m.GetName(), err)
+		return nil, nil
+	}
+	var initializers []string
+	for _, containers := range volumes {
+		for _, c := range containers {
+			if !slices.Contains(initializers, c.Initializer) {
+				initializers = append(initializers, c.Initializer)
+			}
+		}
+	}
+	slices.Sort(initializers)
+	return initializers, nil
+}
+
+// volumesAnnotation returns the annotation mapping the name of each volume to the init containers of the injections
+// for it in evaluation order, along with the volumes recorded by a previous admission.
+func volumesAnnotation(recorded map[string][]InitializedVolume, injections []*injection) (string, error) {
+	volumes := maps.Clone(recorded)
+	if volumes == nil {
+		volumes = map[string][]InitializedVolume{}
+	}
+	for _, i := range injections {
+		volumes[i.VolumeName] = append(volumes[i.VolumeName], InitializedVolume{
+			Container:     i.ContainerName,
+			Initializer:   i.Initializer,
+			Generation:    i.initializer.Generation,
+			PVCMatcher:    i.PVCMatcher,
+			InitContainer: i.Container.Name,
+			Priority:      i.Priority,
+		})
+	}
+	value, err := json.Marshal(volumes)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// decide returns the admission response of the pod along with the init containers injected,
+// or the error the response denies the pod for, and records how its volumes are evaluated in trace if it's not nil.
+// The trace is added to the pod's annotations if the pod has the LabelExplain label.
+func (a *Admitter) decide(ctx context.Context, reqInfo *ReqInfo, trace *MatchTrace) (*admissionv1.AdmissionResponse, []*injection, error) {
 	if reqInfo == nil || reqInfo.Pod == nil || len(reqInfo.Pod.Spec.Volumes) == 0 {
-		return toV1AdmissionResponseWithPatch(nil)
+		return toV1AdmissionResponseWithPatch(nil), nil, nil
+	}
+
+	// opt-outs are honored before anything is matched
+	if reason := a.podOptedOut(ctx, reqInfo); reason != "" {
+		klog.Infof("skip pod %s: %s", podDisplayName(reqInfo.Pod), reason)
+		trace.skip(reason)
+		return toV1AdmissionResponseWithPatch(nil), nil, nil
 	}
 
 	var containerNames []string
+	for _, c := range reqInfo.Pod.Spec.InitContainers {
+		containerNames = append(containerNames, c.Name)
+	}
 	for _, c := range reqInfo.Pod.Spec.Containers {
 		containerNames = append(containerNames, c.Name)
 	}
 
 	initializerList := &v1alpha1.InitializerList{}
-	err = a.client.List(ctx, initializerList)
+	err := a.client.List(ctx, initializerList)
 	if err != nil {
 		klog.ErrorS(err, "failed to list Initializers")
-		return toV1AdmissionResponse(err)
+		return toV1AdmissionResponse(err), nil, err
+	}
+
+	pvcInitializers := sortPVCInitializers(initializerList)
+
+	// The volumes recorded by a previous admission of the pod already have their init containers,
+	// and are not evaluated again, so that reinvocations of the webhook don't change the pod.
+	// An invalid annotation is ignored, and overwritten if init containers are injected.
+	initializedVolumes, err := recordedVolumes(reqInfo.Pod, AnnotationInitializedVolumes)
+	if err != nil {
+		reqInfo.warn("ignore invalid annotation %s: %v", AnnotationInitializedVolumes, err)
+	}
+	auditedVolumes, err := recordedVolumes(reqInfo.Pod, AnnotationAuditedVolumes)
+	if err != nil {
+		reqInfo.warn("ignore invalid annotation %s: %v", AnnotationAuditedVolumes, err)
 	}
 
-	var initContainersToAdd []*corev1.Container
+	var initContainersToAdd []*injectedInitContainer
+	// injections are in evaluation order, along with the ones Initializers in Audit mode would have done
+	var injections []*injection
 	for _, volume := range reqInfo.Pod.Spec.Volumes {
-		if volume.PersistentVolumeClaim != nil {
-			pvc := &corev1.PersistentVolumeClaim{}
-			err = a.client.Get(ctx, types.NamespacedName{
-				Namespace: reqInfo.Pod.Namespace,
-				Name:      volume.PersistentVolumeClaim.ClaimName,
-			}, pvc)
-			if err != nil {
-				klog.ErrorS(err, "failed to get PersistentVolumeClaim", "namespace", reqInfo.Pod.Namespace, "name", volume.PersistentVolumeClaim.ClaimName)
-				return toV1AdmissionResponse(err)
+		volumeTrace := trace.addVolume(&volume)
+		if _, ok := initializedVolumes[volume.Name]; ok {
+			volumeTrace.skip("already initialized, see annotation %s", AnnotationInitializedVolumes)
+			continue
+		}
+		if _, ok := auditedVolumes[volume.Name]; ok {
+			volumeTrace.skip("already audited, see annotation %s", AnnotationAuditedVolumes)
+			continue
+		}
+		if volumeOptedOut(reqInfo.Pod, &volume) {
+			volumeTrace.skip("pod has the annotation %s%s=true", volume.Name, AnnotationSkipVolumeSuffix)
+			continue
+		}
+		var pvc *corev1.PersistentVolumeClaim
+		var volumeType v1alpha1.VolumeType
+		var claimName string
+		switch {
+		case volume.PersistentVolumeClaim != nil:
+			volumeType = v1alpha1.VolumeTypePersistentVolumeClaim
+			claimName = volume.PersistentVolumeClaim.ClaimName
+			pvc, err = a.getPVC(ctx, reqInfo, claimName)
+			if errors.IsNotFound(err) && a.missingPVCPolicy == MissingPVCPolicySkip {
+				reqInfo.warn("pvc %s not found, volume %s is not initialized", claimName, volume.Name)
+				volumeTrace.skip("pvc %s not found", claimName)
+				continue
+			}
+		case volume.Ephemeral != nil && volume.Ephemeral.VolumeClaimTemplate != nil:
+			volumeType = v1alpha1.VolumeTypeEphemeral
+			claimName = ephemeralPVCName(reqInfo.Pod, &volume)
+			pvc, err = a.synthesizeEphemeralPVC(ctx, reqInfo, &volume)
+		default:
+			volumeTrace.skip("neither a persistentVolumeClaim nor an ephemeral volume")
+			continue
+		}
+		if err != nil {
+			// the PVC doesn't exist, or can't be read, e.g. the StorageClasses can't be listed to find the default one
+			failure := a.pvcLookupFailed(reqInfo, &volume, claimName, volumeType, pvcInitializers, volumeTrace, err)
+			if failure != nil {
+				klog.ErrorS(err, "failed to get PersistentVolumeClaim", "namespace", reqInfo.Pod.Namespace, "name", claimName, "volume", volume.Name)
+				return toV1AdmissionResponse(failure), nil, failure
 			}
-			var pvcInitContainer *PVCInitContainer
-			pvcInitContainer, err = a.getPVCInitContainer(ctx, reqInfo, pvc, initializerList)
-			if err != nil {
-				klog.ErrorS(err, "failed to get PVCInitContainer", "pvc", pvc.Name)
-				return toV1AdmissionResponse(err)
+			continue
+		}
+		volumeTrace.setPVC(pvc, volumeType)
+		if pvcOptedOut(pvc) {
+			volumeTrace.skip("pvc %s has the label %s=%s", pvc.Name, LabelInitializer, LabelValueDisabled)
+			continue
+		}
+
+		var pvcInitContainers []*PVCInitContainer
+		pvcInitContainers, err = a.getPVCInitContainers(ctx, reqInfo, pvc, volumeType, pvcInitializers, volumeTrace)
+		if err != nil {
+			klog.ErrorS(err, "failed to get PVCInitContainers", "pvc", pvc.Name)
+			return toV1AdmissionResponse(err), nil, err
+		}
+		if len(pvcInitContainers) == 0 {
+			// the pvc of an ephemeral volume of a pod created with generateName has no name yet
+			if pvc.Name == "" && selectsPVCNames(pvcInitializers, volumeType) {
+				reqInfo.warn("pod has no name yet, the pvc name of ephemeral volume %s can't be predicted and no pvcInitializer matches it without", volume.Name)
 			}
-			if pvcInitContainer == nil {
-				klog.Infof("no initContainer matches pvc %s", pvc.Name)
-				continue
+			klog.Infof("no initContainer matches pvc %s", pvc.Name)
+			continue
+		}
+		for _, pvcInitContainer := range pvcInitContainers {
+			container := a.buildInitContainer(reqInfo.Pod, &volume, pvcInitContainer)
+			// init containers of the same name of different Initializers are told apart by the Initializer name
+			if slices.ContainsFunc(injections, func(i *injection) bool { return !i.Audit && i.ContainerName == container.Name }) {
+				container.Name = injectedContainerName(pvcInitContainer.Initializer, pvcInitContainer.Container.Name, volume.Name)
 			}
-			if pvcInitContainer.MountPathRoot == "" {
-				pvcInitContainer.MountPathRoot = "/"
+
+			if pvcInitContainer.Audit {
+				volumeTrace.audit(container.Name)
+				injections = append(injections, &injection{
+					PVCInitContainer: pvcInitContainer,
+					ContainerName:    container.Name,
+					VolumeName:       volume.Name,
+				})
+				continue
 			}
-			container := pvcInitContainer.Container
-			container.Name = fmt.Sprintf("%s-vol-%s", container.Name, volume.Name)
 
 			// check if the container already exists
 			if slices.Contains(containerNames, container.Name) {
-				klog.Warningf("initContainer %s already exists in pod or patch", container.Name)
+				reqInfo.warn("init container %s already exists in the pod, volume %s is not initialized by Initializer %s",
+					container.Name, volume.Name, pvcInitContainer.Initializer)
 				continue
 			}
 			containerNames = append(containerNames, container.Name)
-
-			mountPath := path.Join(pvcInitContainer.MountPathRoot, volume.Name)
-			volumeMount := corev1.VolumeMount{
-				Name:      volume.Name,
-				MountPath: path.Join(pvcInitContainer.MountPathRoot, volume.Name),
-			}
-			container.VolumeMounts = append(container.VolumeMounts, volumeMount)
-			envVarMountPath := corev1.EnvVar{
-				Name:  EnvVarPVC1MountPath,
-				Value: mountPath,
-			}
-			container.Env = append(container.Env, envVarMountPath)
-
-			uid, gid := a.getVolumeUIDGIDFromPodLabels(volume.Name, reqInfo.Pod)
-			if uid != "" {
-				envVarUID := corev1.EnvVar{
-					Name:  EnvVarPVC1UID,
-					Value: uid,
-				}
-				container.Env = append(container.Env, envVarUID)
-			}
-			if gid != "" {
-				envVarGID := corev1.EnvVar{
-					Name:  EnvVarPVC1GID,
-					Value: gid,
-				}
-				container.Env = append(container.Env, envVarGID)
-			}
-
-			initContainersToAdd = append(initContainersToAdd, container)
+			volumeTrace.inject(container.Name)
+
+			initContainersToAdd = append(initContainersToAdd, &injectedInitContainer{
+				Container: container,
+				Position:  pvcInitContainer.Position,
+			})
+			injections = append(injections, &injection{
+				PVCInitContainer: pvcInitContainer,
+				ContainerName:    container.Name,
+				VolumeName:       volume.Name,
+			})
 		}
 	}
 
-	if len(initContainersToAdd) > 0 {
-		patch, err := initContainersToPatch(initContainersToAdd)
+	var ops []patchOperation
+	annotations := map[string]string{}
+	var injected, audited []*injection
+	var warnings []string
+	for _, i := range injections {
+		if !i.Audit {
+			injected = append(injected, i)
+			continue
+		}
+		audited = append(audited, i)
+		warnings = append(warnings, fmt.Sprintf("Initializer %s in Audit mode would inject init container %s for volume %s",
+			i.Initializer, i.ContainerName, i.VolumeName))
+	}
+	if len(injected) > 0 {
+		annotations[AnnotationInitializedVolumes], err = volumesAnnotation(initializedVolumes, injected)
 		if err != nil {
 			klog.ErrorS(err, "failed to generate patch")
-			return toV1AdmissionResponse(err)
+			return toV1AdmissionResponse(err), nil, err
 		}
-		return toV1AdmissionResponseWithPatch(patch)
+		ops = initContainersPatchOps(reqInfo.Pod, initContainersToAdd)
+	}
+	if len(audited) > 0 {
+		annotations[AnnotationAuditedVolumes], err = volumesAnnotation(auditedVolumes, audited)
+		if err != nil {
+			klog.ErrorS(err, "failed to generate patch")
+			return toV1AdmissionResponse(err), nil, err
+		}
+	}
+	// the trace of a reinvocation which injects nothing is not recorded, so that the pod is not changed
+	_, traced := reqInfo.Pod.Annotations[AnnotationMatchTrace]
+	if trace != nil && reqInfo.Pod.Labels[LabelExplain] == "true" && (!traced || len(injections) > 0) {
+		annotations[AnnotationMatchTrace], err = matchTraceAnnotation(trace)
+		if err != nil {
+			klog.ErrorS(err, "failed to generate patch")
+			return toV1AdmissionResponse(err), nil, err
+		}
+	}
+	ops = append(ops, annotationsPatchOps(reqInfo.Pod, annotations)...)
+	if len(ops) == 0 {
+		return toV1AdmissionResponseWithPatch(nil), nil, nil
 	}
 
-	return toV1AdmissionResponseWithPatch(nil)
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		klog.ErrorS(err, "failed to generate patch")
+		return toV1AdmissionResponse(err), nil, err
+	}
+	resp := toV1AdmissionResponseWithPatch(patch)
+	resp.Warnings = warnings
+	return resp, injections, nil
+}
+
+// buildInitContainer returns the init container to inject for the volume, with the volume mounted,
+// or attached as a device if the PVC is in block mode, and the environment variables describing it set.
+func (a *Admitter) buildInitContainer(pod *corev1.Pod, volume *corev1.Volume, pvcInitContainer *PVCInitContainer) *corev1.Container {
+	container := pvcInitContainer.Container.DeepCopy()
+	container.Name = injectedContainerName("", container.Name, volume.Name)
+
+	if isBlockPVC(pvcInitContainer.PVC) {
+		devicePathRoot := pvcInitContainer.DevicePathRoot
+		if devicePathRoot == "" {
+			devicePathRoot = "/dev"
+		}
+		devicePath := path.Join(devicePathRoot, volume.Name)
+		volumeDevice := corev1.VolumeDevice{
+			Name:       volume.Name,
+			DevicePath: devicePath,
+		}
+		container.VolumeDevices = append(container.VolumeDevices, volumeDevice)
+		envVarDevicePath := corev1.EnvVar{
+			Name:  EnvVarPVC1DevicePath,
+			Value: devicePath,
+		}
+		container.Env = append(container.Env, envVarDevicePath)
+	} else {
+		mountPathRoot := pvcInitContainer.MountPathRoot
+		if mountPathRoot == "" {
+			mountPathRoot = "/"
+		}
+		mountPath := path.Join(mountPathRoot, volume.Name)
+		volumeMount := corev1.VolumeMount{
+			Name:      volume.Name,
+			MountPath: mountPath,
+		}
+		container.VolumeMounts = append(container.VolumeMounts, volumeMount)
+		envVarMountPath := corev1.EnvVar{
+			Name:  EnvVarPVC1MountPath,
+			Value: mountPath,
+		}
+		container.Env = append(container.Env, envVarMountPath)
+	}
+
+	uid, gid := a.getVolumeUIDGIDFromPodLabels(volume.Name, pod)
+	if uid != "" {
+		envVarUID := corev1.EnvVar{
+			Name:  EnvVarPVC1UID,
+			Value: uid,
+		}
+		container.Env = append(container.Env, envVarUID)
+	}
+	if gid != "" {
+		envVarGID := corev1.EnvVar{
+			Name:  EnvVarPVC1GID,
+			Value: gid,
+		}
+		container.Env = append(container.Env, envVarGID)
+	}
+	return container
+}
+
+// injectedContainerName returns the name of the init container injected for the volume, <container>-vol-<volume>,
+// or <initializer>-<container>-vol-<volume> if initializer is set, so that Initializers can have init containers
+// of the same name. Dots of the Initializer name are replaced, and names longer than a DNS label are truncated
+// and suffixed with a hash of the full name to stay unique.
+func injectedContainerName(initializer, container, volume string) string {
+	name := fmt.Sprintf("%s-vol-%s", container, volume)
+	if initializer != "" {
+		name = strings.ReplaceAll(initializer, ".", "-") + "-" + name
+	}
+	if len(name) <= validation.DNS1123LabelMaxLength {
+		return name
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	suffix := fmt.Sprintf("-%08x", h.Sum32())
+	return strings.TrimRight(name[:validation.DNS1123LabelMaxLength-len(suffix)], "-") + suffix
 }
 
 const (
-	podsInitContainerPatch string = `[
-		 {"op":"add","path":"/spec/initContainers","value":%s}
-	]`
 	LabelVolumeUID         = "volume.storage.kubesphere.io/uid"
 	LabelVolumeGID         = "volume.storage.kubesphere.io/gid"
 	LabelSpecificVolumeUID = "%s.volume.storage.kubesphere.io/uid"
@@ -264,132 +638,274 @@ func (a *Admitter) getVolumeUIDGIDFromPodLabels(volumeName string, pod *corev1.P
 	return
 }
 
-func initContainersToPatch(initContainers []*corev1.Container) ([]byte, error) {
-	containersBytes, err := json.Marshal(initContainers)
-	if err != nil {
-		return nil, err
-	}
-	patch := fmt.Sprintf(podsInitContainerPatch, string(containersBytes))
-	return []byte(patch), nil
-}
-
 type PVCInitContainer struct {
-	PVC           *corev1.PersistentVolumeClaim
-	Container     *corev1.Container
-	MountPathRoot string
+	Initializer    string
+	PVCMatcher     string
+	Priority       int32
+	PVC            *corev1.PersistentVolumeClaim
+	Container      *corev1.Container
+	MountPathRoot  string
+	DevicePathRoot string
+	Position       *v1alpha1.InitContainerPosition
+	// Audit is set if the Initializer is in Audit mode, so the init container is only reported, not injected.
+	Audit bool
+
+	// initializer is the Initializer the init container comes from, to record events against.
+	initializer *v1alpha1.Initializer
 }
 
-// getPVCInitContainer returns a PVInitContainer that matches the pvc.
+// getPVCInitContainers returns the PVCInitContainers that match the pvc, in evaluation order (see sortPVCInitializers).
 // If pvc does not match any pvcMatcher, nil will be returned.
-// If pvc matches multiple pvcMatchers, the first one will be used and the corresponding initContainer will be returned.
-func (a *Admitter) getPVCInitContainer(ctx context.Context, reqInfo *ReqInfo, pvc *corev1.PersistentVolumeClaim, initializerList *v1alpha1.InitializerList) (*PVCInitContainer, error) {
-	getPvcMatcherByName := func(matcherName string, pvcMatchers []v1alpha1.PVCMatcher) *v1alpha1.PVCMatcher {
-		for _, m := range pvcMatchers {
-			if m.Name == matcherName {
-				return &m
-			}
-		}
-		return nil
-	}
-
+// Once a PVCInitializer whose MatchPolicy is "First" matches, the evaluation stops,
+// otherwise it goes on, so multiple initContainers may be returned for the same pvc.
+// An initContainer referenced by multiple matching PVCInitializers of the same Initializer is only returned once,
+// Initializers may have initContainers of the same name though, which are all returned.
+// PVCInitializers of Initializers in Audit mode never stop the evaluation, their PVCInitContainers have Audit set.
+// Each evaluated PVCInitializer is recorded in trace if it's not nil.
+func (a *Admitter) getPVCInitContainers(ctx context.Context, reqInfo *ReqInfo, pvc *corev1.PersistentVolumeClaim, volumeType v1alpha1.VolumeType, pvcInitializers []*sortedPVCInitializer, trace *VolumeTrace) ([]*PVCInitContainer, error) {
 	getContainerByName := func(name string, containers []corev1.Container) *corev1.Container {
 		for _, c := range containers {
 			if c.Name == name {
-				return &c
+				return c.DeepCopy()
 			}
 		}
 		return nil
 	}
 
-	for _, initializer := range initializerList.Items {
-		if !initializer.Spec.Enabled {
-			klog.Infof("initializer %s not enabled", initializer.Name)
+	var pvcInitContainers []*PVCInitContainer
+	for _, p := range pvcInitializers {
+		initializer, pvcInitializer := p.Initializer, p.PVCInitializer
+		pvcMatcher := getPVCMatcher(initializer, pvcInitializer.PVCMatcherName)
+		if pvcMatcher == nil {
+			reqInfo.warn("pvcMatcher %s not found in Initializer %s, pvc %s is not evaluated against it",
+				pvcInitializer.PVCMatcherName, initializer.Name, pvc.Name)
+			trace.evaluate(p, EvaluationInvalid, "", "pvcMatcher not found")
 			continue
 		}
-		for _, pvcInitializer := range initializer.Spec.PVCInitializers {
-			pvcMatcher := getPvcMatcherByName(pvcInitializer.PVCMatcherName, initializer.Spec.PVCMatchers)
-			match, err := a.pvcMatch(ctx, reqInfo.Pod, pvc, pvcMatcher)
-			if err != nil {
-				return nil, err
-			}
-			if match {
-				container := getContainerByName(pvcInitializer.InitContainerName, initializer.Spec.InitContainers)
-				if container == nil {
-					klog.Warningf("initContainer %s not found in initializer %s", pvcInitializer.InitContainerName, initializer.Name)
-					continue
-				}
-				pvcInitContainer := &PVCInitContainer{
-					PVC:           pvc,
-					Container:     container,
-					MountPathRoot: pvcInitializer.MountPathRoot,
-				}
-				return pvcInitContainer, nil
+		rejectedBy, reason, err := a.pvcMatch(ctx, reqInfo.Pod, pvc, volumeType, pvcMatcher)
+		if err != nil {
+			failurePolicy := getFailurePolicy(initializer, pvcInitializer)
+			if failurePolicy == v1alpha1.FailurePolicyIgnore {
+				reqInfo.warn("failed to match pvc %s against pvcMatcher %s of Initializer %s, skip it as %s: %v",
+					pvc.Name, pvcMatcher.Name, initializer.Name, describeFailurePolicy(initializer, failurePolicy), err)
+				trace.evaluate(p, EvaluationIgnored, rejectedBy, fmt.Sprintf("%v, %s", err, describeFailurePolicy(initializer, failurePolicy)))
+				continue
 			}
+			trace.evaluate(p, EvaluationError, rejectedBy, fmt.Sprintf("%v, failurePolicy is %s", err, failurePolicy))
+			return nil, &injectionFailure{ClaimName: pvc.Name, PVC: pvc, Initializer: initializer, FailurePolicy: failurePolicy, Err: err}
+		}
+		if rejectedBy != "" {
+			trace.evaluate(p, EvaluationNotMatched, rejectedBy, reason)
+			continue
+		}
+		container := getContainerByName(pvcInitializer.InitContainerName, initializer.Spec.InitContainers)
+		if container == nil {
+			reqInfo.warn("initContainer %s not found in Initializer %s, pvc %s matches pvcMatcher %s but is not initialized",
+				pvcInitializer.InitContainerName, initializer.Name, pvc.Name, pvcMatcher.Name)
+			trace.evaluate(p, EvaluationInvalid, "", "initContainer not found")
+			continue
+		}
+		if initializer.Spec.Mode == v1alpha1.InitializerModeAudit {
+			trace.evaluate(p, EvaluationAudited, "", "initializer is in Audit mode")
+			pvcInitContainers = append(pvcInitContainers, &PVCInitContainer{
+				Initializer:    initializer.Name,
+				PVCMatcher:     pvcMatcher.Name,
+				Priority:       p.Priority,
+				PVC:            pvc,
+				Container:      container,
+				MountPathRoot:  pvcInitializer.MountPathRoot,
+				DevicePathRoot: pvcInitializer.DevicePathRoot,
+				Position:       pvcInitializer.Position,
+				Audit:          true,
+				initializer:    initializer,
+			})
+			continue
+		}
+		matchPolicy := getMatchPolicy(initializer, pvcInitializer)
+		duplicated := slices.ContainsFunc(pvcInitContainers, func(c *PVCInitContainer) bool {
+			return !c.Audit && c.Initializer == initializer.Name && c.Container.Name == container.Name
+		})
+		if duplicated {
+			klog.Infof("initContainer %s of initializer %s already matches pvc %s, skip it", container.Name, initializer.Name, pvc.Name)
+			trace.evaluate(p, EvaluationDuplicated, "", fmt.Sprintf("initContainer already matches, matchPolicy is %s", matchPolicy))
+		} else {
+			trace.evaluate(p, EvaluationMatched, "", fmt.Sprintf("matchPolicy is %s", matchPolicy))
+			pvcInitContainers = append(pvcInitContainers, &PVCInitContainer{
+				Initializer:    initializer.Name,
+				PVCMatcher:     pvcMatcher.Name,
+				Priority:       p.Priority,
+				PVC:            pvc,
+				Container:      container,
+				MountPathRoot:  pvcInitializer.MountPathRoot,
+				DevicePathRoot: pvcInitializer.DevicePathRoot,
+				Position:       pvcInitializer.Position,
+				initializer:    initializer,
+			})
+		}
+		if matchPolicy == v1alpha1.MatchPolicyFirst {
+			return pvcInitContainers, nil
+		}
+	}
+	return pvcInitContainers, nil
+}
+
+// pvcLookupFailed applies the failure policies of the PVCInitializers which may match the volume when its PVC can't be read
+// nor synthesized, or doesn't exist and --missing-pvc-policy is Deny: if the failurePolicy of any of them is "Fail",
+// the failure the pod is denied for is returned, otherwise the volume is skipped with a warning and nil is returned.
+// The PVCInitializers whose pvcMatcher rejects the volume type or the pod can't match the volume whatever its PVC,
+// so their policy doesn't apply, and the ones of Initializers in Audit mode never deny the pod, see getFailurePolicy.
+func (a *Admitter) pvcLookupFailed(reqInfo *ReqInfo, volume *corev1.Volume, claimName string, volumeType v1alpha1.VolumeType, pvcInitializers []*sortedPVCInitializer, trace *VolumeTrace, err error) *injectionFailure {
+	trace.setPVC(&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: claimName}}, volumeType)
+	var ignored int
+	for _, p := range pvcInitializers {
+		initializer, pvcInitializer := p.Initializer, p.PVCInitializer
+		pvcMatcher := getPVCMatcher(initializer, pvcInitializer.PVCMatcherName)
+		if pvcMatcher == nil {
+			continue
+		}
+		if len(pvcMatcher.VolumeTypes) > 0 && !slices.Contains(pvcMatcher.VolumeTypes, volumeType) {
+			continue
+		}
+		if pvcMatcher.Pod != nil && pvcMatcher.Pod.Explain(reqInfo.Pod) != "" {
+			continue
+		}
+		failurePolicy := getFailurePolicy(initializer, pvcInitializer)
+		if failurePolicy == v1alpha1.FailurePolicyFail {
+			trace.evaluate(p, EvaluationError, "pvc", fmt.Sprintf("%v, failurePolicy is %s", err, failurePolicy))
+			return &injectionFailure{ClaimName: claimName, Initializer: initializer, FailurePolicy: failurePolicy, Err: err}
+		}
+		trace.evaluate(p, EvaluationIgnored, "pvc", fmt.Sprintf("%v, %s", err, describeFailurePolicy(initializer, failurePolicy)))
+		ignored++
+	}
+	if ignored > 0 {
+		reqInfo.warn("failed to get pvc %s, volume %s is not initialized as the failurePolicy of the pvcInitializers which may match it is Ignore: %v",
+			claimName, volume.Name, err)
+	} else {
+		klog.Infof("failed to get pvc %s, skip volume %s which no pvcInitializer may match: %v", claimName, volume.Name, err)
+		trace.skip("failed to get pvc %s, and no pvcInitializer may match it: %v", claimName, err)
+	}
+	return nil
+}
+
+// getPVCMatcher returns the PVCMatcher of the Initializer with the name, nil if it doesn't exist.
+func getPVCMatcher(initializer *v1alpha1.Initializer, name string) *v1alpha1.PVCMatcher {
+	for i := range initializer.Spec.PVCMatchers {
+		if initializer.Spec.PVCMatchers[i].Name == name {
+			return &initializer.Spec.PVCMatchers[i]
 		}
 	}
-	return nil, nil
+	return nil
+}
+
+// getMatchPolicy returns the MatchPolicy of the PVCInitializer, which defaults to the one of the Initializer.
+func getMatchPolicy(initializer *v1alpha1.Initializer, pvcInitializer *v1alpha1.PVCInitializer) v1alpha1.MatchPolicy {
+	if pvcInitializer.MatchPolicy != "" {
+		return pvcInitializer.MatchPolicy
+	}
+	if initializer.Spec.MatchPolicy != "" {
+		return initializer.Spec.MatchPolicy
+	}
+	return v1alpha1.MatchPolicyFirst
+}
+
+// getFailurePolicy returns the FailurePolicy of the PVCInitializer, which defaults to the one of the Initializer, then to "Fail".
+// It's always "Ignore" for Initializers in Audit mode, which must never deny pods.
+func getFailurePolicy(initializer *v1alpha1.Initializer, pvcInitializer *v1alpha1.PVCInitializer) v1alpha1.FailurePolicy {
+	if initializer.Spec.Mode == v1alpha1.InitializerModeAudit {
+		return v1alpha1.FailurePolicyIgnore
+	}
+	if pvcInitializer.FailurePolicy != "" {
+		return pvcInitializer.FailurePolicy
+	}
+	if initializer.Spec.FailurePolicy != "" {
+		return initializer.Spec.FailurePolicy
+	}
+	return v1alpha1.FailurePolicyFail
+}
+
+// describeFailurePolicy returns why the failure policy applies, for warnings and traces.
+func describeFailurePolicy(initializer *v1alpha1.Initializer, failurePolicy v1alpha1.FailurePolicy) string {
+	if initializer.Spec.Mode == v1alpha1.InitializerModeAudit {
+		return "the Initializer is in Audit mode"
+	}
+	return fmt.Sprintf("failurePolicy is %s", failurePolicy)
 }
 
-func (a *Admitter) pvcMatch(ctx context.Context, pod *corev1.Pod, pvc *corev1.PersistentVolumeClaim, pvcMatcher *v1alpha1.PVCMatcher) (bool, error) {
-	var err error
+// pvcMatch returns the part of the pvcMatcher which rejects the pvc and why,
+// one of volumeTypes, volumeModes, pvc, pod, storageClass, namespace, workspace. An empty rejectedBy means a match.
+func (a *Admitter) pvcMatch(ctx context.Context, pod *corev1.Pod, pvc *corev1.PersistentVolumeClaim, volumeType v1alpha1.VolumeType, pvcMatcher *v1alpha1.PVCMatcher) (rejectedBy, reason string, err error) {
+	if len(pvcMatcher.VolumeTypes) > 0 && !slices.Contains(pvcMatcher.VolumeTypes, volumeType) {
+		return "volumeTypes", fmt.Sprintf("volume type %s not in %v", volumeType, pvcMatcher.VolumeTypes), nil
+	}
+
+	if len(pvcMatcher.VolumeModes) > 0 && !slices.Contains(pvcMatcher.VolumeModes, getVolumeMode(pvc)) {
+		return "volumeModes", fmt.Sprintf("volume mode %s not in %v", getVolumeMode(pvc), pvcMatcher.VolumeModes), nil
+	}
 
 	if pvcMatcher.PVC != nil {
-		match := pvcMatcher.PVC.Match(pvc)
-		if !match {
-			return false, nil
+		if reason = pvcMatcher.PVC.Explain(pvc); reason != "" {
+			return "pvc", reason, nil
 		}
 	}
 
 	if pvcMatcher.Pod != nil {
-		match := pvcMatcher.Pod.Match(pod)
-		if !match {
-			return false, nil
+		if reason = pvcMatcher.Pod.Explain(pod); reason != "" {
+			return "pod", reason, nil
 		}
 	}
 
 	if pvcMatcher.StorageClass != nil && pvc.Spec.StorageClassName != nil {
 		if *pvc.Spec.StorageClassName == "" {
-			return false, nil
+			return "storageClass", "pvc has an empty storageClassName", nil
 		}
 		sc := &v1.StorageClass{}
 		err = a.client.Get(ctx, types.NamespacedName{Name: *pvc.Spec.StorageClassName}, sc)
 		if err != nil {
-			return false, err
+			return "storageClass", "", err
 		}
-		match := pvcMatcher.StorageClass.Match(sc)
-		if !match {
-			return false, nil
+		if reason = pvcMatcher.StorageClass.Explain(sc); reason != "" {
+			return "storageClass", reason, nil
 		}
 	}
 
 	ns := &corev1.Namespace{}
 	err = a.client.Get(ctx, types.NamespacedName{Name: pvc.Namespace}, ns)
 	if err != nil {
-		return false, err
+		return "namespace", "", err
 	}
 
 	if pvcMatcher.Namespace != nil {
-		match := pvcMatcher.Namespace.Match(ns)
-		if !match {
-			return false, nil
+		if reason = pvcMatcher.Namespace.Explain(ns); reason != "" {
+			return "namespace", reason, nil
 		}
 	}
 
 	wsName, ok := ns.Labels["kubesphere.io/workspace"]
 	if ok && pvcMatcher.Workspace != nil {
 		if wsName == "" {
-			return false, nil
+			return "workspace", "namespace has an empty workspace label", nil
 		}
 		ws := &tenantv1alpha1.Workspace{}
 		err = a.client.Get(ctx, types.NamespacedName{Name: wsName}, ws)
 		if err != nil {
-			return false, err
+			return "workspace", "", err
 		}
-		match := pvcMatcher.Workspace.Match(ws)
-		if !match {
-			return false, nil
+		if reason = pvcMatcher.Workspace.Explain(ws); reason != "" {
+			return "workspace", reason, nil
 		}
 	}
 
-	return true, nil
+	return "", "", nil
+}
+
+// getVolumeMode returns the volumeMode of the PVC, which defaults to "Filesystem".
+func getVolumeMode(pvc *corev1.PersistentVolumeClaim) corev1.PersistentVolumeMode {
+	if pvc.Spec.VolumeMode == nil {
+		return corev1.PersistentVolumeFilesystem
+	}
+	return *pvc.Spec.VolumeMode
+}
+
+func isBlockPVC(pvc *corev1.PersistentVolumeClaim) bool {
+	return getVolumeMode(pvc) == corev1.PersistentVolumeBlock
 }
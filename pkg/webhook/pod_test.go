@@ -0,0 +1,1053 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// newTestAdmitter returns an Admitter reading objs from a fake client, with the default flags.
+func newTestAdmitter(objs ...client.Object) *Admitter {
+	return newTestAdmitterWithInterceptor(interceptor.Funcs{}, objs...)
+}
+
+// newTestAdmitterWithInterceptor returns an Admitter like newTestAdmitter, whose client calls are intercepted by funcs.
+func newTestAdmitterWithInterceptor(funcs interceptor.Funcs, objs ...client.Object) *Admitter {
+	cli := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithInterceptorFuncs(funcs).Build()
+	return &Admitter{client: cli, missingPVCPolicy: MissingPVCPolicyDeny, namespacePolicy: NamespacePolicyOptOut}
+}
+
+// failGets returns interceptor functions failing the Gets of the objects of the same type as obj.
+func failGets(obj client.Object) interceptor.Funcs {
+	return interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, o client.Object, opts ...client.GetOption) error {
+			if reflect.TypeOf(o) == reflect.TypeOf(obj) {
+				return apierrors.NewServiceUnavailable("unavailable")
+			}
+			return c.Get(ctx, key, o, opts...)
+		},
+	}
+}
+
+// newTestInitializer returns an enabled Initializer injecting its only init container for all volumes.
+func newTestInitializer(name, initContainer string) *v1alpha1.Initializer {
+	return &v1alpha1.Initializer{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1alpha1.InitializerSpec{
+			Enabled:         true,
+			InitContainers:  []corev1.Container{{Name: initContainer, Image: "busybox"}},
+			PVCMatchers:     []v1alpha1.PVCMatcher{{Name: "all"}},
+			PVCInitializers: []v1alpha1.PVCInitializer{{PVCMatcherName: "all", InitContainerName: initContainer}},
+		},
+	}
+}
+
+func newTestNamespace(labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: labels}}
+}
+
+func newTestPVC(name string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name)}}
+}
+
+func pvcVolume(name, claimName string) corev1.Volume {
+	return corev1.Volume{Name: name, VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName}}}
+}
+
+// newTestPod returns the pod p in the default namespace, with a volume of the same name for each of the pvcs.
+func newTestPod(pvcs ...string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "default"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "c", Image: "busybox"}}},
+	}
+	for _, pvc := range pvcs {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, pvcVolume(pvc, pvc))
+	}
+	return pod
+}
+
+// patchPod returns pod patched by resp.
+func patchPod(t *testing.T, pod *corev1.Pod, resp *admissionv1.AdmissionResponse) *corev1.Pod {
+	t.Helper()
+	pod, err := applyAdmissionPatch(pod, resp.Patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pod
+}
+
+// containerNames returns the names of the injected init containers of a volume recorded in an annotation.
+func containerNames(containers []InitializedVolume) []string {
+	var names []string
+	for _, c := range containers {
+		names = append(names, c.Container)
+	}
+	return names
+}
+
+func initContainerNames(pod *corev1.Pod) []string {
+	var names []string
+	for _, c := range pod.Spec.InitContainers {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func TestDecideReinvocation(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		labels map[string]string
+	}{
+		{name: "default"},
+		{name: "explain", labels: map[string]string{LabelExplain: "true"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := newTestAdmitter(newTestInitializer("chown", "chown"), newTestNamespace(nil), newTestPVC("data"), newTestPVC("logs"))
+
+			pod := newTestPod("data")
+			pod.Labels = tc.labels
+			pod = patchPod(t, pod, a.Decide(context.Background(), NewReqInfo(pod)))
+			if diff := cmp.Diff([]string{"chown-vol-data"}, initContainerNames(pod)); diff != "" {
+				t.Fatalf("unexpected init containers (-want +got):\n%s", diff)
+			}
+			if _, traced := pod.Annotations[AnnotationMatchTrace]; traced != (tc.labels != nil) {
+				t.Errorf("expected annotation %s %t, got %t", AnnotationMatchTrace, tc.labels != nil, traced)
+			}
+
+			// reinvoked with the mutated pod
+			if resp := a.Decide(context.Background(), NewReqInfo(pod)); len(resp.Patch) != 0 {
+				t.Errorf("expected no patch on reinvocation, got %s", resp.Patch)
+			}
+
+			// reinvoked after another webhook added a volume no Initializer matches
+			pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{Name: "tmp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}})
+			if resp := a.Decide(context.Background(), NewReqInfo(pod)); len(resp.Patch) != 0 {
+				t.Errorf("expected no patch on reinvocation, got %s", resp.Patch)
+			}
+
+			// reinvoked after another webhook added a volume to initialize
+			pod.Spec.Volumes = append(pod.Spec.Volumes, pvcVolume("logs", "logs"))
+			pod = patchPod(t, pod, a.Decide(context.Background(), NewReqInfo(pod)))
+			if diff := cmp.Diff([]string{"chown-vol-logs", "chown-vol-data"}, initContainerNames(pod)); diff != "" {
+				t.Errorf("unexpected init containers (-want +got):\n%s", diff)
+			}
+			volumes, err := recordedVolumes(pod, AnnotationInitializedVolumes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]string{"chown-vol-data"}, containerNames(volumes["data"])); diff != "" {
+				t.Errorf("unexpected init containers of volume data in annotation %s (-want +got):\n%s", AnnotationInitializedVolumes, diff)
+			}
+			if diff := cmp.Diff([]string{"chown-vol-logs"}, containerNames(volumes["logs"])); diff != "" {
+				t.Errorf("unexpected init containers of volume logs in annotation %s (-want +got):\n%s", AnnotationInitializedVolumes, diff)
+			}
+		})
+	}
+}
+
+func TestDecideDryRun(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		dryRun bool
+	}{
+		{name: "dry run", dryRun: true},
+		{name: "default"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			a := newTestAdmitter(newTestInitializer("chown", "chown"), newTestNamespace(nil), newTestPVC("data"))
+			a.events = &eventRecorder{recorder: recorder}
+
+			pod := newTestPod("data")
+			pod.Name, pod.GenerateName = "", "p-"
+			reqInfo := NewReqInfo(pod)
+			reqInfo.DryRun = tc.dryRun
+			resp := a.Decide(context.Background(), reqInfo)
+			if len(resp.Patch) == 0 {
+				t.Errorf("expected the pod to be patched")
+			}
+			if n := len(recorder.Events); (n > 0) == tc.dryRun {
+				t.Errorf("expected events %t, got %d", !tc.dryRun, n)
+			}
+		})
+	}
+}
+
+func TestDecideWarnings(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		pvcInitializers []v1alpha1.PVCInitializer
+		pvcs            []string
+		warnings        []string
+	}{
+		{
+			name: "missing references",
+			pvcInitializers: []v1alpha1.PVCInitializer{
+				{PVCMatcherName: "missing", InitContainerName: "chown"},
+				{PVCMatcherName: "all", InitContainerName: "missing"},
+			},
+			pvcs: []string{"data"},
+			warnings: []string{
+				"pvcMatcher missing not found in Initializer chown, pvc data is not evaluated against it",
+				"initContainer missing not found in Initializer chown, pvc data matches pvcMatcher all but is not initialized",
+			},
+		},
+		{
+			name:     "missing pvc skipped",
+			warnings: []string{"pvc data not found, volume data is not initialized"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			initializer := newTestInitializer("chown", "chown")
+			if tc.pvcInitializers != nil {
+				initializer.Spec.PVCInitializers = tc.pvcInitializers
+			}
+			objects := []client.Object{initializer, newTestNamespace(nil)}
+			for _, pvc := range tc.pvcs {
+				objects = append(objects, newTestPVC(pvc))
+			}
+			a := newTestAdmitter(objects...)
+			a.missingPVCPolicy = MissingPVCPolicySkip
+
+			resp := a.Decide(context.Background(), NewReqInfo(newTestPod("data")))
+			if !resp.Allowed || len(resp.Patch) != 0 {
+				t.Errorf("expected the pod to be allowed without patch, got allowed %v, patch %s", resp.Allowed, resp.Patch)
+			}
+			if diff := cmp.Diff(tc.warnings, resp.Warnings); diff != "" {
+				t.Errorf("unexpected warnings (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecideFailurePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		failurePolicy  v1alpha1.FailurePolicy
+		mode           v1alpha1.InitializerMode
+		allowed        bool
+		initContainers []string
+		warnings       int
+	}{
+		{name: "default", allowed: false},
+		{name: "fail", failurePolicy: v1alpha1.FailurePolicyFail, allowed: false},
+		{name: "ignore", failurePolicy: v1alpha1.FailurePolicyIgnore, allowed: true, initContainers: []string{"chmod-vol-data"}, warnings: 1},
+		// Initializers in Audit mode never deny pods, the chmod they would inject is warned about too
+		{name: "audit", failurePolicy: v1alpha1.FailurePolicyFail, mode: v1alpha1.InitializerModeAudit, allowed: true, warnings: 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			initializer := newTestInitializer("init", "chmod")
+			initializer.Spec.Mode = tc.mode
+			initializer.Spec.InitContainers = append(initializer.Spec.InitContainers, corev1.Container{Name: "chown", Image: "busybox"})
+			initializer.Spec.PVCMatchers = append(initializer.Spec.PVCMatchers, v1alpha1.PVCMatcher{Name: "local", StorageClass: &v1alpha1.GenericSelector{}})
+			initializer.Spec.PVCInitializers = append([]v1alpha1.PVCInitializer{
+				{PVCMatcherName: "local", InitContainerName: "chown", FailurePolicy: tc.failurePolicy},
+			}, initializer.Spec.PVCInitializers...)
+			// the StorageClass of the pvc doesn't exist, so it can't be matched
+			storageClassName := "local"
+			pvc := newTestPVC("data")
+			pvc.Spec.StorageClassName = &storageClassName
+			a := newTestAdmitter(initializer, newTestNamespace(nil), pvc)
+
+			pod := newTestPod("data")
+			resp := a.Decide(context.Background(), NewReqInfo(pod))
+			if resp.Allowed != tc.allowed {
+				t.Fatalf("expected allowed %v, got %v: %v", tc.allowed, resp.Allowed, resp.Result)
+			}
+			if !resp.Allowed {
+				return
+			}
+			if len(resp.Warnings) != tc.warnings {
+				t.Errorf("expected %d warnings, got %v", tc.warnings, resp.Warnings)
+			}
+			if diff := cmp.Diff(tc.initContainers, initContainerNames(patchPod(t, pod, resp))); diff != "" {
+				t.Errorf("unexpected init containers (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecideAudit(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// enforceMatchPolicy adds an Initializer in Enforce mode if it's set
+		enforceMatchPolicy v1alpha1.MatchPolicy
+		auditPriority      int32
+		initContainers     []string
+		audited            []string
+		evaluations        []string
+	}{
+		{
+			name:        "audit only",
+			audited:     []string{"chown-vol-data"},
+			evaluations: []string{"audit:Audited"},
+		},
+		// the matchPolicy of an Initializer in Audit mode never stops the evaluation
+		{
+			name:               "audit before enforce",
+			enforceMatchPolicy: v1alpha1.MatchPolicyFirst,
+			auditPriority:      10,
+			initContainers:     []string{"chown-vol-data"},
+			audited:            []string{"chown-vol-data"},
+			evaluations:        []string{"audit:Audited", "enforce:Matched"},
+		},
+		// the audited init container is named as if it was injected after the one of the other Initializer
+		{
+			name:               "audit after enforce",
+			enforceMatchPolicy: v1alpha1.MatchPolicyAll,
+			auditPriority:      -10,
+			initContainers:     []string{"chown-vol-data"},
+			audited:            []string{"audit-chown-vol-data"},
+			evaluations:        []string{"enforce:Matched", "audit:Audited"},
+		},
+		{
+			name:               "audit after enforce which stops the evaluation",
+			enforceMatchPolicy: v1alpha1.MatchPolicyFirst,
+			auditPriority:      -10,
+			initContainers:     []string{"chown-vol-data"},
+			evaluations:        []string{"enforce:Matched"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			audit := newTestInitializer("audit", "chown")
+			audit.Spec.Mode = v1alpha1.InitializerModeAudit
+			audit.Spec.Priority = tc.auditPriority
+			audit.Spec.MatchPolicy = v1alpha1.MatchPolicyFirst
+			objects := []client.Object{audit, newTestNamespace(nil), newTestPVC("data")}
+			if tc.enforceMatchPolicy != "" {
+				enforce := newTestInitializer("enforce", "chown")
+				enforce.Spec.MatchPolicy = tc.enforceMatchPolicy
+				objects = append(objects, enforce)
+			}
+			recorder := record.NewFakeRecorder(10)
+			a := newTestAdmitter(objects...)
+			a.events = &eventRecorder{recorder: recorder}
+
+			pod := newTestPod("data")
+			pod.Name, pod.GenerateName = "", "p-"
+			pod.Labels = map[string]string{LabelExplain: "true"}
+			resp := a.Decide(context.Background(), NewReqInfo(pod))
+			if !resp.Allowed {
+				t.Fatalf("expected the pod to be allowed, got %v", resp.Result)
+			}
+			pod = patchPod(t, pod, resp)
+			if diff := cmp.Diff(tc.initContainers, initContainerNames(pod)); diff != "" {
+				t.Errorf("unexpected init containers (-want +got):\n%s", diff)
+			}
+
+			volumes, err := recordedVolumes(pod, AnnotationAuditedVolumes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			audited := containerNames(volumes["data"])
+			if diff := cmp.Diff(tc.audited, audited); diff != "" {
+				t.Errorf("unexpected audited init containers in annotation %s (-want +got):\n%s", AnnotationAuditedVolumes, diff)
+			}
+			var warnings []string
+			for _, c := range audited {
+				warnings = append(warnings, "Initializer audit in Audit mode would inject init container "+c+" for volume data")
+			}
+			if diff := cmp.Diff(warnings, resp.Warnings); diff != "" {
+				t.Errorf("unexpected warnings (-want +got):\n%s", diff)
+			}
+
+			trace := &MatchTrace{}
+			if err = json.Unmarshal([]byte(pod.Annotations[AnnotationMatchTrace]), trace); err != nil {
+				t.Fatal(err)
+			}
+			var evaluations []string
+			for _, e := range trace.Volumes[0].Evaluations {
+				evaluations = append(evaluations, e.Initializer+":"+string(e.Result))
+			}
+			if diff := cmp.Diff(tc.evaluations, evaluations); diff != "" {
+				t.Errorf("unexpected evaluations (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.audited, trace.Volumes[0].Audited); diff != "" {
+				t.Errorf("unexpected audited init containers in the trace (-want +got):\n%s", diff)
+			}
+
+			// the Initializer and the PVC get an event for each init container
+			auditedEvents := 0
+			for len(recorder.Events) > 0 {
+				if e := <-recorder.Events; strings.Contains(e, ReasonInjectionAudited) {
+					auditedEvents++
+				}
+			}
+			if auditedEvents != 2*len(tc.audited) {
+				t.Errorf("expected %d %s events, got %d", 2*len(tc.audited), ReasonInjectionAudited, auditedEvents)
+			}
+		})
+	}
+}
+
+func TestDecideOptOut(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		namespacePolicy NamespacePolicy
+		nsLabels        map[string]string
+		podLabels       map[string]string
+		podAnnotations  map[string]string
+		pvcLabels       map[string]string
+		initContainers  []string
+	}{
+		{
+			name:           "default",
+			initContainers: []string{"chown-vol-data", "chown-vol-logs"},
+		},
+		{
+			name:     "namespace opted out",
+			nsLabels: map[string]string{LabelInitializer: LabelValueDisabled},
+		},
+		{
+			name:      "pod opted out",
+			podLabels: map[string]string{LabelInitializer: LabelValueDisabled},
+		},
+		{
+			name:           "volume opted out",
+			podAnnotations: map[string]string{"data" + AnnotationSkipVolumeSuffix: "true"},
+			initContainers: []string{"chown-vol-logs"},
+		},
+		{
+			name:           "pvc opted out",
+			pvcLabels:      map[string]string{LabelInitializer: LabelValueDisabled},
+			initContainers: []string{"chown-vol-logs"},
+		},
+		{
+			name:            "namespace not opted in",
+			namespacePolicy: NamespacePolicyOptIn,
+		},
+		{
+			name:            "namespace opted in",
+			namespacePolicy: NamespacePolicyOptIn,
+			nsLabels:        map[string]string{LabelInitializer: LabelValueEnabled},
+			initContainers:  []string{"chown-vol-data", "chown-vol-logs"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := newTestPVC("data")
+			data.Labels = tc.pvcLabels
+			a := newTestAdmitter(newTestInitializer("chown", "chown"), newTestNamespace(tc.nsLabels), data, newTestPVC("logs"))
+			if tc.namespacePolicy != "" {
+				a.namespacePolicy = tc.namespacePolicy
+			}
+
+			pod := newTestPod("data", "logs")
+			pod.Labels, pod.Annotations = tc.podLabels, tc.podAnnotations
+			resp := a.Decide(context.Background(), NewReqInfo(pod))
+			if !resp.Allowed {
+				t.Fatalf("expected the pod to be allowed, got %v", resp.Result)
+			}
+			if diff := cmp.Diff(tc.initContainers, initContainerNames(patchPod(t, pod, resp))); diff != "" {
+				t.Errorf("unexpected init containers (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecideSameContainerNames(t *testing.T) {
+	withMatchPolicyAll := func(initializer *v1alpha1.Initializer) *v1alpha1.Initializer {
+		initializer.Spec.MatchPolicy = v1alpha1.MatchPolicyAll
+		return initializer
+	}
+	// the init container is referenced by two pvcInitializers of the Initializer
+	twice := withMatchPolicyAll(newTestInitializer("app", "init"))
+	twice.Spec.PVCMatchers = append(twice.Spec.PVCMatchers, v1alpha1.PVCMatcher{Name: "data", PVC: &v1alpha1.GenericSelector{}})
+	twice.Spec.PVCInitializers = append(twice.Spec.PVCInitializers, v1alpha1.PVCInitializer{PVCMatcherName: "data", InitContainerName: "init"})
+
+	for _, tc := range []struct {
+		name           string
+		initializers   []client.Object
+		initContainers []string
+		evaluations    []EvaluationResult
+	}{
+		// the init containers of the following Initializers are prefixed with the Initializer name
+		{
+			name:           "different Initializers",
+			initializers:   []client.Object{withMatchPolicyAll(newTestInitializer("platform", "init")), withMatchPolicyAll(newTestInitializer("app", "init"))},
+			initContainers: []string{"init-vol-data", "platform-init-vol-data"},
+			evaluations:    []EvaluationResult{EvaluationMatched, EvaluationMatched},
+		},
+		{
+			name:           "same Initializer",
+			initializers:   []client.Object{twice},
+			initContainers: []string{"init-vol-data"},
+			evaluations:    []EvaluationResult{EvaluationMatched, EvaluationDuplicated},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := newTestAdmitter(append(tc.initializers, newTestNamespace(nil), newTestPVC("data"))...)
+
+			pod := newTestPod("data")
+			resp, trace := a.Explain(context.Background(), NewReqInfo(pod))
+			if diff := cmp.Diff(tc.initContainers, initContainerNames(patchPod(t, pod, resp))); diff != "" {
+				t.Errorf("unexpected init containers (-want +got):\n%s", diff)
+			}
+			var evaluations []EvaluationResult
+			for _, e := range trace.Volumes[0].Evaluations {
+				evaluations = append(evaluations, e.Result)
+			}
+			if diff := cmp.Diff(tc.evaluations, evaluations); diff != "" {
+				t.Errorf("unexpected evaluations (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestInjectedContainerName(t *testing.T) {
+	for _, tc := range []struct {
+		initializer, container, volume string
+		want                           string
+	}{
+		{container: "init", volume: "data", want: "init-vol-data"},
+		{initializer: "app", container: "init", volume: "data", want: "app-init-vol-data"},
+		{initializer: "app.example.com", container: "init", volume: "data", want: "app-example-com-init-vol-data"},
+	} {
+		if got := injectedContainerName(tc.initializer, tc.container, tc.volume); got != tc.want {
+			t.Errorf("injectedContainerName(%q, %q, %q) = %q, want %q", tc.initializer, tc.container, tc.volume, got, tc.want)
+		}
+	}
+
+	long := strings.Repeat("a", 40)
+	name := injectedContainerName(long, "init", long)
+	if len(name) > validation.DNS1123LabelMaxLength {
+		t.Errorf("expected at most %d characters, got %d: %s", validation.DNS1123LabelMaxLength, len(name), name)
+	}
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		t.Errorf("expected a DNS label, got %s: %v", name, errs)
+	}
+	if other := injectedContainerName(long, "init", long+"b"); other == name {
+		t.Errorf("expected truncated names of different volumes to differ, got %s", name)
+	}
+}
+
+func TestVolumesAnnotation(t *testing.T) {
+	initializer := &v1alpha1.Initializer{ObjectMeta: metav1.ObjectMeta{Name: "chown", Generation: 3}}
+	newInjection := func(volume string) *injection {
+		return &injection{
+			PVCInitContainer: &PVCInitContainer{
+				Initializer: "chown",
+				PVCMatcher:  "all",
+				Priority:    10,
+				Container:   &corev1.Container{Name: "chown"},
+				initializer: initializer,
+			},
+			ContainerName: "chown-vol-" + volume,
+			VolumeName:    volume,
+		}
+	}
+
+	value, err := volumesAnnotation(nil, []*injection{newInjection("data"), newInjection("logs")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"data":[{"container":"chown-vol-data","initializer":"chown","generation":3,"pvcMatcher":"all","initContainer":"chown","priority":10}],` +
+		`"logs":[{"container":"chown-vol-logs","initializer":"chown","generation":3,"pvcMatcher":"all","initContainer":"chown","priority":10}]}`
+	if value != want {
+		t.Errorf("unexpected annotation:\nwant %s\ngot  %s", want, value)
+	}
+
+	// the volumes of a reinvocation are added to the recorded ones
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{AnnotationInitializedVolumes: value}}}
+	recorded, err := recordedVolumes(pod, AnnotationInitializedVolumes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err = volumesAnnotation(recorded, []*injection{newInjection("cache")}); err != nil {
+		t.Fatal(err)
+	}
+	pod.Annotations[AnnotationInitializedVolumes] = value
+	merged, err := recordedVolumes(pod, AnnotationInitializedVolumes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded["cache"] = []InitializedVolume{{
+		Container:     "chown-vol-cache",
+		Initializer:   "chown",
+		Generation:    3,
+		PVCMatcher:    "all",
+		InitContainer: "chown",
+		Priority:      10,
+	}}
+	if diff := cmp.Diff(recorded, merged); diff != "" {
+		t.Errorf("unexpected merged volumes (-want +got):\n%s", diff)
+	}
+
+	pod.Annotations[AnnotationInitializedVolumes] = "["
+	if _, err = recordedVolumes(pod, AnnotationInitializedVolumes); err == nil {
+		t.Error("expected an error for an invalid annotation")
+	}
+}
+
+func TestInjectedInitializers(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		annotation string
+		want       []string
+	}{
+		{name: "no annotation"},
+		{
+			name: "injected",
+			annotation: `{"data":[{"container":"mkfs-vol-data","initializer":"mkfs"},{"container":"chown-vol-data","initializer":"chown"}],` +
+				`"logs":[{"container":"chown-vol-logs","initializer":"chown"}]}`,
+			want: []string{"chown", "mkfs"},
+		},
+		// invalid annotations don't fail the index
+		{name: "invalid annotation", annotation: "{"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pod := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: "p", Namespace: "default"}}
+			if tc.annotation != "" {
+				pod.Annotations = map[string]string{AnnotationInitializedVolumes: tc.annotation}
+			}
+			got, err := injectedInitializers(pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected initializers (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecidePVCLookupFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		failurePolicy v1alpha1.FailurePolicy
+		mode          v1alpha1.InitializerMode
+		volumeTypes   []v1alpha1.VolumeType
+		allowed       bool
+		warnings      int
+	}{
+		{name: "default", allowed: false},
+		{name: "ignore", failurePolicy: v1alpha1.FailurePolicyIgnore, allowed: true, warnings: 1},
+		{name: "audit", failurePolicy: v1alpha1.FailurePolicyFail, mode: v1alpha1.InitializerModeAudit, allowed: true, warnings: 1},
+		// no pvcInitializer may match the volume, so the failure doesn't matter
+		{name: "no candidate", volumeTypes: []v1alpha1.VolumeType{v1alpha1.VolumeTypeEphemeral}, allowed: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			initializer := newTestInitializer("init", "chown")
+			initializer.Spec.Mode = tc.mode
+			initializer.Spec.FailurePolicy = tc.failurePolicy
+			initializer.Spec.PVCMatchers[0].VolumeTypes = tc.volumeTypes
+			a := newTestAdmitterWithInterceptor(failGets(&corev1.PersistentVolumeClaim{}), initializer, newTestNamespace(nil))
+
+			resp, trace := a.Explain(context.Background(), NewReqInfo(newTestPod("data")))
+			if resp.Allowed != tc.allowed {
+				t.Fatalf("expected allowed %v, got %v: %v", tc.allowed, resp.Allowed, resp.Result)
+			}
+			if !resp.Allowed {
+				if !strings.Contains(resp.Result.Message, "failurePolicy of Initializer init is Fail") {
+					t.Errorf("expected the failurePolicy in the message, got %q", resp.Result.Message)
+				}
+				if e := trace.Volumes[0].Evaluations; len(e) != 1 || e[0].Result != EvaluationError {
+					t.Errorf("expected an Error evaluation, got %v", e)
+				}
+				return
+			}
+			if len(resp.Warnings) != tc.warnings {
+				t.Errorf("expected %d warnings, got %v", tc.warnings, resp.Warnings)
+			}
+			if len(resp.Patch) != 0 {
+				t.Errorf("expected no patch, got %s", resp.Patch)
+			}
+		})
+	}
+}
+
+func TestDecideMissingPVC(t *testing.T) {
+	notFound := `persistentvolumeclaims "data" not found`
+	for _, tc := range []struct {
+		name             string
+		missingPVCPolicy MissingPVCPolicy
+		// initializer is the mode and failurePolicy of the only Initializer, there is none if it's nil
+		initializer *v1alpha1.InitializerSpec
+		volumeTypes []v1alpha1.VolumeType
+		allowed     bool
+		warnings    []string
+	}{
+		{name: "fail", initializer: &v1alpha1.InitializerSpec{}, allowed: false},
+		{
+			name:        "ignore",
+			initializer: &v1alpha1.InitializerSpec{FailurePolicy: v1alpha1.FailurePolicyIgnore},
+			allowed:     true,
+			warnings:    []string{"failed to get pvc data, volume data is not initialized as the failurePolicy of the pvcInitializers which may match it is Ignore: " + notFound},
+		},
+		// Initializers in Audit mode never deny pods
+		{
+			name:        "audit",
+			initializer: &v1alpha1.InitializerSpec{Mode: v1alpha1.InitializerModeAudit, FailurePolicy: v1alpha1.FailurePolicyFail},
+			allowed:     true,
+			warnings:    []string{"failed to get pvc data, volume data is not initialized as the failurePolicy of the pvcInitializers which may match it is Ignore: " + notFound},
+		},
+		{name: "no candidate", initializer: &v1alpha1.InitializerSpec{}, volumeTypes: []v1alpha1.VolumeType{v1alpha1.VolumeTypeEphemeral}, allowed: true},
+		{name: "no Initializer", allowed: true},
+		{
+			name:             "skip",
+			missingPVCPolicy: MissingPVCPolicySkip,
+			initializer:      &v1alpha1.InitializerSpec{},
+			allowed:          true,
+			warnings:         []string{"pvc data not found, volume data is not initialized"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			objects := []client.Object{newTestNamespace(nil)}
+			if tc.initializer != nil {
+				initializer := newTestInitializer("init", "chown")
+				initializer.Spec.Mode = tc.initializer.Mode
+				initializer.Spec.FailurePolicy = tc.initializer.FailurePolicy
+				initializer.Spec.PVCMatchers[0].VolumeTypes = tc.volumeTypes
+				objects = append(objects, initializer)
+			}
+			a := newTestAdmitter(objects...)
+			if tc.missingPVCPolicy != "" {
+				a.missingPVCPolicy = tc.missingPVCPolicy
+			}
+
+			resp := a.Decide(context.Background(), NewReqInfo(newTestPod("data")))
+			if resp.Allowed != tc.allowed {
+				t.Fatalf("expected allowed %v, got %v: %v", tc.allowed, resp.Allowed, resp.Result)
+			}
+			if !resp.Allowed {
+				return
+			}
+			if diff := cmp.Diff(tc.warnings, resp.Warnings); diff != "" {
+				t.Errorf("unexpected warnings (-want +got):\n%s", diff)
+			}
+			if len(resp.Patch) != 0 {
+				t.Errorf("expected no patch, got %s", resp.Patch)
+			}
+		})
+	}
+}
+
+func TestDecideNamespaceLookupFailure(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		failurePolicy v1alpha1.FailurePolicy
+		allowed       bool
+	}{
+		{name: "fail", failurePolicy: v1alpha1.FailurePolicyFail, allowed: false},
+		{name: "ignore", failurePolicy: v1alpha1.FailurePolicyIgnore, allowed: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			initializer := newTestInitializer("init", "chown")
+			initializer.Spec.FailurePolicy = tc.failurePolicy
+			a := newTestAdmitterWithInterceptor(failGets(&corev1.Namespace{}), initializer, newTestPVC("data"))
+
+			// the opt-out check doesn't deny the pod, the pvcMatcher which reads the namespace too decides
+			resp := a.Decide(context.Background(), NewReqInfo(newTestPod("data")))
+			if resp.Allowed != tc.allowed {
+				t.Fatalf("expected allowed %v, got %v: %v", tc.allowed, resp.Allowed, resp.Result)
+			}
+			if len(resp.Warnings) == 0 || !strings.HasPrefix(resp.Warnings[0], "failed to get namespace default") {
+				t.Errorf("expected a warning about the namespace, got %v", resp.Warnings)
+			}
+		})
+	}
+}
+
+func TestDecideStatefulSet(t *testing.T) {
+	newStorageClass := func(name string, isDefault bool, created time.Time) *storagev1.StorageClass {
+		sc := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)}}
+		if isDefault {
+			sc.Annotations = map[string]string{annotationIsDefaultStorageClass: "true"}
+		}
+		return sc
+	}
+	fast, slow := "fast", "slow"
+	now := time.Now()
+
+	for _, tc := range []struct {
+		name             string
+		pvc              *corev1.PersistentVolumeClaim
+		storageClassName *string
+		storageClasses   []client.Object
+		claimName        string
+		allowed          bool
+		initContainers   []string
+		warnings         []string
+	}{
+		{
+			name: "pvc exists",
+			pvc: &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "data-web-0", Namespace: "default"},
+				Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &slow},
+			},
+			storageClassName: &fast,
+			allowed:          true,
+			initContainers:   []string{"slow-vol-data"},
+		},
+		{
+			name:             "pvc synthesized from the volumeClaimTemplate",
+			storageClassName: &fast,
+			allowed:          true,
+			initContainers:   []string{"fast-vol-data"},
+		},
+		// the newest default StorageClass is used, like the DefaultStorageClass admission plugin does
+		{
+			name: "pvc synthesized with the default StorageClass",
+			storageClasses: []client.Object{
+				newStorageClass("fast", true, now.Add(-time.Hour)),
+				newStorageClass("slow", true, now),
+			},
+			allowed:        true,
+			initContainers: []string{"slow-vol-data"},
+		},
+		// storageClass selectors don't reject a pvc without storageClassName
+		{
+			name:           "pvc synthesized without default StorageClass",
+			storageClasses: []client.Object{newStorageClass("slow", false, now)},
+			allowed:        true,
+			initContainers: []string{"fast-vol-data"},
+			warnings:       []string{"no default StorageClass, pvc data-web-0 is evaluated without a storageClassName"},
+		},
+		{
+			name:      "pvc missing and not from a volumeClaimTemplate",
+			claimName: "other-web-0",
+			allowed:   false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			initializer := &v1alpha1.Initializer{
+				ObjectMeta: metav1.ObjectMeta{Name: "init"},
+				Spec: v1alpha1.InitializerSpec{
+					Enabled:        true,
+					InitContainers: []corev1.Container{{Name: "fast", Image: "busybox"}, {Name: "slow", Image: "busybox"}},
+					PVCMatchers: []v1alpha1.PVCMatcher{
+						{Name: "fast", StorageClass: &v1alpha1.GenericSelector{FieldSelector: []metav1.FieldSelectorRequirement{
+							{Key: v1alpha1.FieldName, Operator: metav1.FieldSelectorOpIn, Values: []string{"fast"}},
+						}}},
+						{Name: "slow", StorageClass: &v1alpha1.GenericSelector{FieldSelector: []metav1.FieldSelectorRequirement{
+							{Key: v1alpha1.FieldName, Operator: metav1.FieldSelectorOpIn, Values: []string{"slow"}},
+						}}},
+					},
+					PVCInitializers: []v1alpha1.PVCInitializer{
+						{PVCMatcherName: "fast", InitContainerName: "fast"},
+						{PVCMatcherName: "slow", InitContainerName: "slow"},
+					},
+				},
+			}
+			sts := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+				Spec: appsv1.StatefulSetSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+					VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+						ObjectMeta: metav1.ObjectMeta{Name: "data"},
+						Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: tc.storageClassName},
+					}},
+				},
+			}
+			objects := []client.Object{initializer, sts, newTestNamespace(nil)}
+			if tc.storageClasses == nil {
+				tc.storageClasses = []client.Object{newStorageClass("fast", false, now), newStorageClass("slow", false, now)}
+			}
+			objects = append(objects, tc.storageClasses...)
+			if tc.pvc != nil {
+				objects = append(objects, tc.pvc)
+			}
+			a := newTestAdmitter(objects...)
+
+			claimName := tc.claimName
+			if claimName == "" {
+				claimName = "data-web-0"
+			}
+			isController := true
+			pod := newTestPod()
+			pod.Name = "web-0"
+			pod.Labels = map[string]string{"app": "web"}
+			pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "web", Controller: &isController}}
+			pod.Spec.Volumes = []corev1.Volume{pvcVolume("data", claimName)}
+			resp, trace := a.Explain(context.Background(), NewReqInfo(pod))
+			if resp.Allowed != tc.allowed {
+				t.Fatalf("expected allowed %v, got %v: %v", tc.allowed, resp.Allowed, resp.Result)
+			}
+			if !resp.Allowed {
+				return
+			}
+			if diff := cmp.Diff(tc.warnings, resp.Warnings); diff != "" {
+				t.Errorf("unexpected warnings (-want +got):\n%s", diff)
+			}
+			if pvc := trace.Volumes[0].PVC; pvc != "data-web-0" {
+				t.Errorf("expected pvc data-web-0 in the trace, got %q", pvc)
+			}
+			if diff := cmp.Diff(tc.initContainers, initContainerNames(patchPod(t, pod, resp))); diff != "" {
+				t.Errorf("unexpected init containers (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecideEphemeral(t *testing.T) {
+	byName := &v1alpha1.GenericSelector{FieldSelector: []metav1.FieldSelectorRequirement{
+		{Key: v1alpha1.FieldName, Operator: metav1.FieldSelectorOpIn, Values: []string{"db-scratch"}},
+	}}
+	for _, tc := range []struct {
+		name           string
+		podName        string
+		volumeTypes    []v1alpha1.VolumeType
+		pvcSelector    *v1alpha1.GenericSelector
+		pvc            string
+		initContainers []string
+		warnings       []string
+	}{
+		{
+			name:           "named pod",
+			podName:        "db",
+			pvc:            "db-scratch",
+			initContainers: []string{"chown-vol-scratch"},
+		},
+		// the pvc is still evaluated, only its name is unknown
+		{
+			name:           "generateName only",
+			initContainers: []string{"chown-vol-scratch"},
+		},
+		{
+			name:           "pvc selected by name",
+			podName:        "db",
+			pvcSelector:    byName,
+			pvc:            "db-scratch",
+			initContainers: []string{"chown-vol-scratch"},
+		},
+		{
+			name:        "pvc selected by name, generateName only",
+			pvcSelector: byName,
+			warnings:    []string{"pod has no name yet, the pvc name of ephemeral volume scratch can't be predicted and no pvcInitializer matches it without"},
+		},
+		{
+			name:        "pvcMatcher for persistentVolumeClaim volumes only",
+			podName:     "db",
+			volumeTypes: []v1alpha1.VolumeType{v1alpha1.VolumeTypePersistentVolumeClaim},
+			pvc:         "db-scratch",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			initializer := newTestInitializer("init", "chown")
+			initializer.Spec.PVCMatchers[0].VolumeTypes = tc.volumeTypes
+			initializer.Spec.PVCMatchers[0].PVC = &v1alpha1.GenericSelector{LabelSelector: []metav1.LabelSelectorRequirement{
+				{Key: "purpose", Operator: metav1.LabelSelectorOpIn, Values: []string{"scratch"}},
+			}}
+			if tc.pvcSelector != nil {
+				initializer.Spec.PVCMatchers[0].PVC = tc.pvcSelector
+			}
+			storageClassName := "local"
+			a := newTestAdmitter(initializer, newTestNamespace(nil), &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: storageClassName}})
+
+			pod := newTestPod()
+			pod.Name, pod.GenerateName = tc.podName, "db-"
+			pod.Spec.Volumes = []corev1.Volume{{
+				Name: "scratch",
+				VolumeSource: corev1.VolumeSource{Ephemeral: &corev1.EphemeralVolumeSource{
+					VolumeClaimTemplate: &corev1.PersistentVolumeClaimTemplate{
+						ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"purpose": "scratch"}},
+						Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &storageClassName},
+					},
+				}},
+			}}
+			resp, trace := a.Explain(context.Background(), NewReqInfo(pod))
+			if !resp.Allowed {
+				t.Fatalf("expected the pod to be allowed, got %v", resp.Result)
+			}
+			if diff := cmp.Diff(tc.warnings, resp.Warnings); diff != "" {
+				t.Errorf("unexpected warnings (-want +got):\n%s", diff)
+			}
+			if v := trace.Volumes[0]; v.VolumeType != v1alpha1.VolumeTypeEphemeral || v.PVC != tc.pvc {
+				t.Errorf("expected an ephemeral volume of pvc %q in the trace, got %s volume of pvc %q", tc.pvc, v.VolumeType, v.PVC)
+			}
+			if diff := cmp.Diff(tc.initContainers, initContainerNames(patchPod(t, pod, resp))); diff != "" {
+				t.Errorf("unexpected init containers (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecideVolumeMode(t *testing.T) {
+	block, filesystem := corev1.PersistentVolumeBlock, corev1.PersistentVolumeFilesystem
+	for _, tc := range []struct {
+		name           string
+		volumeMode     *corev1.PersistentVolumeMode
+		volumeModes    []corev1.PersistentVolumeMode
+		devicePathRoot string
+		mountPathRoot  string
+		// want is the injected init container, nil if none
+		want *corev1.Container
+	}{
+		{
+			name:       "block",
+			volumeMode: &block,
+			want: &corev1.Container{
+				Name:          "wipe-vol-data",
+				VolumeDevices: []corev1.VolumeDevice{{Name: "data", DevicePath: "/dev/data"}},
+				Env:           []corev1.EnvVar{{Name: EnvVarPVC1DevicePath, Value: "/dev/data"}},
+			},
+		},
+		{
+			name:           "block with devicePathRoot",
+			volumeMode:     &block,
+			devicePathRoot: "/block",
+			mountPathRoot:  "/mnt",
+			want: &corev1.Container{
+				Name:          "wipe-vol-data",
+				VolumeDevices: []corev1.VolumeDevice{{Name: "data", DevicePath: "/block/data"}},
+				Env:           []corev1.EnvVar{{Name: EnvVarPVC1DevicePath, Value: "/block/data"}},
+			},
+		},
+		// a pvc without volumeMode is a filesystem
+		{
+			name:          "filesystem",
+			mountPathRoot: "/mnt",
+			want: &corev1.Container{
+				Name:         "wipe-vol-data",
+				VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/mnt/data"}},
+				Env:          []corev1.EnvVar{{Name: EnvVarPVC1MountPath, Value: "/mnt/data"}},
+			},
+		},
+		{
+			name:        "filesystem rejected by volumeModes",
+			volumeMode:  &filesystem,
+			volumeModes: []corev1.PersistentVolumeMode{corev1.PersistentVolumeBlock},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			initializer := newTestInitializer("init", "wipe")
+			initializer.Spec.InitContainers[0].Image = ""
+			initializer.Spec.PVCMatchers[0].VolumeModes = tc.volumeModes
+			initializer.Spec.PVCInitializers[0].DevicePathRoot = tc.devicePathRoot
+			initializer.Spec.PVCInitializers[0].MountPathRoot = tc.mountPathRoot
+			pvc := newTestPVC("data")
+			pvc.Spec.VolumeMode = tc.volumeMode
+			a := newTestAdmitter(initializer, newTestNamespace(nil), pvc)
+
+			pod := newTestPod("data")
+			resp := a.Decide(context.Background(), NewReqInfo(pod))
+			if !resp.Allowed {
+				t.Fatalf("expected the pod to be allowed, got %v", resp.Result)
+			}
+			var want []corev1.Container
+			if tc.want != nil {
+				want = append(want, *tc.want)
+			}
+			if diff := cmp.Diff(want, patchPod(t, pod, resp).Spec.InitContainers); diff != "" {
+				t.Errorf("unexpected init containers (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	"k8s.io/klog/v2"
+)
+
+// sortedPVCInitializer is a PVCInitializer of an enabled Initializer, along with its effective priority.
+type sortedPVCInitializer struct {
+	Initializer    *v1alpha1.Initializer
+	PVCInitializer *v1alpha1.PVCInitializer
+	Priority       int32
+}
+
+// sortPVCInitializers returns the PVCInitializers of all enabled Initializers in evaluation order:
+// by priority from high to low, then by Initializer name, then in the order they are defined in the Initializer.
+// The priority of a PVCInitializer defaults to the priority of its Initializer.
+func sortPVCInitializers(initializerList *v1alpha1.InitializerList) []*sortedPVCInitializer {
+	var pvcInitializers []*sortedPVCInitializer
+	for i := range initializerList.Items {
+		initializer := &initializerList.Items[i]
+		if !initializer.Spec.Enabled {
+			klog.Infof("initializer %s not enabled", initializer.Name)
+			continue
+		}
+		for j := range initializer.Spec.PVCInitializers {
+			pvcInitializer := &initializer.Spec.PVCInitializers[j]
+			priority := initializer.Spec.Priority
+			if pvcInitializer.Priority != nil {
+				priority = *pvcInitializer.Priority
+			}
+			pvcInitializers = append(pvcInitializers, &sortedPVCInitializer{
+				Initializer:    initializer,
+				PVCInitializer: pvcInitializer,
+				Priority:       priority,
+			})
+		}
+	}
+	// the stable sort keeps the definition order of PVCInitializers in the same Initializer
+	slices.SortStableFunc(pvcInitializers, func(a, b *sortedPVCInitializer) int {
+		if c := cmp.Compare(b.Priority, a.Priority); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Initializer.Name, b.Initializer.Name)
+	})
+	return pvcInitializers
+}
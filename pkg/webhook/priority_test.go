@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSortPVCInitializers(t *testing.T) {
+	newInitializer := func(name string, enabled bool, priority int32, pvcInitializers ...v1alpha1.PVCInitializer) v1alpha1.Initializer {
+		return v1alpha1.Initializer{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1alpha1.InitializerSpec{
+				Enabled:         enabled,
+				Priority:        priority,
+				PVCInitializers: pvcInitializers,
+			},
+		}
+	}
+	pvcInitializer := func(matcher string) v1alpha1.PVCInitializer {
+		return v1alpha1.PVCInitializer{PVCMatcherName: matcher}
+	}
+	urgent := int32(200)
+
+	for _, tc := range []struct {
+		name         string
+		initializers []v1alpha1.Initializer
+		// want are the sorted PVCInitializers as initializer/pvcMatcher@priority
+		want []string
+	}{
+		{
+			name: "priority from high to low",
+			initializers: []v1alpha1.Initializer{
+				newInitializer("defaults", true, -10, pvcInitializer("all")),
+				newInitializer("app", true, 100, pvcInitializer("app")),
+				newInitializer("platform", true, 0, pvcInitializer("local")),
+			},
+			want: []string{"app/app@100", "platform/local@0", "defaults/all@-10"},
+		},
+		{
+			name: "Initializer name breaks ties",
+			initializers: []v1alpha1.Initializer{
+				newInitializer("zeta", true, 0, pvcInitializer("all")),
+				newInitializer("alpha", true, 0, pvcInitializer("all")),
+				newInitializer("mu", true, 0, pvcInitializer("all")),
+			},
+			want: []string{"alpha/all@0", "mu/all@0", "zeta/all@0"},
+		},
+		{
+			name: "definition order within an Initializer",
+			initializers: []v1alpha1.Initializer{
+				newInitializer("b", true, 0, pvcInitializer("3"), pvcInitializer("1"), pvcInitializer("2")),
+				newInitializer("a", true, 0, pvcInitializer("z"), pvcInitializer("y")),
+			},
+			want: []string{"a/z@0", "a/y@0", "b/3@0", "b/1@0", "b/2@0"},
+		},
+		{
+			name: "PVCInitializer priority overrides the Initializer's",
+			initializers: []v1alpha1.Initializer{
+				newInitializer("app", true, 100, pvcInitializer("app")),
+				newInitializer("platform", true, 0,
+					pvcInitializer("local"),
+					v1alpha1.PVCInitializer{PVCMatcherName: "urgent", Priority: &urgent},
+				),
+			},
+			want: []string{"platform/urgent@200", "app/app@100", "platform/local@0"},
+		},
+		{
+			name: "disabled Initializers are dropped",
+			initializers: []v1alpha1.Initializer{
+				newInitializer("app", false, 100, pvcInitializer("app")),
+				newInitializer("platform", true, 0, pvcInitializer("local")),
+			},
+			want: []string{"platform/local@0"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, p := range sortPVCInitializers(&v1alpha1.InitializerList{Items: tc.initializers}) {
+				got = append(got, fmt.Sprintf("%s/%s@%d", p.Initializer.Name, p.PVCInitializer.PVCMatcherName, p.Priority))
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected order (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/kubesphere/volume-initializer/pkg/apis/storage/v1alpha1"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	renderPodFile          string
+	renderInitializersPath string
+	renderObjectsPath      string
+)
+
+// CmdRender runs the admission of a pod offline, against Initializers and cluster objects read from files.
+var CmdRender = &cobra.Command{
+	Use:   "render",
+	Short: "Show the JSON patch and the mutated pod the webhook would produce for a pod",
+	Long: `Render runs the same decision logic as the webhook against a fake cluster seeded from files,
+and prints the resulting JSON patch and the fully patched pod. No cluster is needed.
+
+The cluster objects are the PVCs, StorageClasses, Namespaces, Workspaces and StatefulSets the
+Initializers are matched against. The pod's namespace is created if it is not in the cluster objects.`,
+	Args:         cobra.MaximumNArgs(0),
+	SilenceUsage: true,
+	RunE:         render,
+}
+
+func init() {
+	addRenderInputFlags(CmdRender)
+}
+
+// addRenderInputFlags adds the flags of the files the pod, Initializers and cluster objects are read from.
+func addRenderInputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&renderPodFile, "pod", "",
+		"File containing the pod to admit. Required.")
+	cmd.Flags().StringVar(&renderInitializersPath, "initializers", "",
+		"File or directory containing the Initializers. Required.")
+	cmd.Flags().StringVar(&renderObjectsPath, "objects", "",
+		"File or directory containing the cluster objects.")
+	cmd.MarkFlagRequired("pod")
+	cmd.MarkFlagRequired("initializers")
+}
+
+func render(cmd *cobra.Command, args []string) error {
+	pod, cli, err := loadRenderInput(renderPodFile, renderInitializersPath, renderObjectsPath)
+	if err != nil {
+		return err
+	}
+
+	resp := NewAdmitterWithClient(cli).Decide(context.Background(), NewReqInfo(pod))
+	if !resp.Allowed {
+		return fmt.Errorf("pod denied: %s", resp.Result.Message)
+	}
+
+	out := cmd.OutOrStdout()
+	patched, err := applyAdmissionPatch(pod, resp.Patch)
+	if err != nil {
+		return err
+	}
+
+	patch := bytes.NewBufferString("[]")
+	if len(resp.Patch) > 0 {
+		patch.Reset()
+		if err = json.Indent(patch, resp.Patch, "", "  "); err != nil {
+			return err
+		}
+	}
+	podYAML, err := yaml.Marshal(patched)
+	if err != nil {
+		return err
+	}
+	for _, w := range resp.Warnings {
+		fmt.Fprintf(out, "# Warning: %s\n", w)
+	}
+	fmt.Fprintf(out, "# JSON patch\n%s\n---\n# Patched pod\n%s", patch, podYAML)
+	return nil
+}
+
+// loadRenderInput reads the pod, and returns it along with a fake client seeded with the Initializers and cluster objects.
+func loadRenderInput(podFile, initializersPath, objectsPath string) (*corev1.Pod, client.Client, error) {
+	podObjs, err := readObjects(podFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(podObjs) != 1 {
+		return nil, nil, fmt.Errorf("expected exactly one pod in %s, got %d objects", podFile, len(podObjs))
+	}
+	pod, ok := podObjs[0].(*corev1.Pod)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected a pod in %s, got %T", podFile, podObjs[0])
+	}
+	if pod.Namespace == "" {
+		pod.Namespace = metav1.NamespaceDefault
+	}
+
+	objs, err := readObjects(initializersPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, obj := range objs {
+		if _, ok := obj.(*v1alpha1.Initializer); !ok {
+			return nil, nil, fmt.Errorf("expected only Initializers in %s, got %T", initializersPath, obj)
+		}
+	}
+	if objectsPath != "" {
+		var clusterObjs []runtime.Object
+		clusterObjs, err = readObjects(objectsPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		objs = append(objs, clusterObjs...)
+	}
+
+	hasNamespace := false
+	for _, obj := range objs {
+		if ns, ok := obj.(*corev1.Namespace); ok && ns.Name == pod.Namespace {
+			hasNamespace = true
+		}
+	}
+	if !hasNamespace {
+		objs = append(objs, &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   pod.Namespace,
+				Labels: map[string]string{corev1.LabelMetadataName: pod.Namespace},
+			},
+		})
+	}
+
+	cli := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).Build()
+	return pod, cli, nil
+}
+
+// readObjects decodes the objects in a file, or in the .yaml, .yml and .json files of a directory.
+// Files may contain multiple YAML documents.
+func readObjects(path string) ([]runtime.Object, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			switch filepath.Ext(e.Name()) {
+			case ".yaml", ".yml", ".json":
+				if !e.IsDir() {
+					files = append(files, filepath.Join(path, e.Name()))
+				}
+			}
+		}
+	}
+
+	var objs []runtime.Object
+	deserializer := codecs.UniversalDeserializer()
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		decoder := utilyaml.NewYAMLOrJSONDecoder(f, 4096)
+		for {
+			raw := runtime.RawExtension{}
+			if err = decoder.Decode(&raw); err != nil {
+				break
+			}
+			if len(strings.TrimSpace(string(raw.Raw))) == 0 || string(raw.Raw) == "null" {
+				continue
+			}
+			obj, _, decodeErr := deserializer.Decode(raw.Raw, nil, nil)
+			if decodeErr != nil {
+				err = fmt.Errorf("failed to decode object in %s: %w", file, decodeErr)
+				break
+			}
+			objs = append(objs, obj)
+		}
+		f.Close()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	}
+	return objs, nil
+}
+
+func applyAdmissionPatch(pod *corev1.Pod, patch []byte) (*corev1.Pod, error) {
+	if len(patch) == 0 {
+		return pod, nil
+	}
+	podBytes, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	patchedBytes, err := decoded.Apply(podBytes)
+	if err != nil {
+		return nil, err
+	}
+	patched := &corev1.Pod{}
+	if err = json.Unmarshal(patchedBytes, patched); err != nil {
+		return nil, err
+	}
+	return patched, nil
+}
@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestRender(t *testing.T) {
+	defer func(pod, initializers, objects string) {
+		renderPodFile, renderInitializersPath, renderObjectsPath = pod, initializers, objects
+	}(renderPodFile, renderInitializersPath, renderObjectsPath)
+
+	testdata := filepath.Join("testdata", "render")
+	for _, tc := range []struct {
+		name               string
+		objects            string
+		wantInitContainers []string
+		wantErr            string
+	}{
+		{
+			name:               "cluster objects",
+			objects:            filepath.Join(testdata, "objects.yaml"),
+			wantInitContainers: []string{"chown-vol-data", "chmod-vol-logs"},
+		},
+		{
+			// the pvcInitializers which may match the missing PVCs have the default failurePolicy Fail
+			name:    "no cluster objects",
+			wantErr: `pod denied: persistentvolumeclaims "data-mongodb-0" not found`,
+		},
+		{
+			name:    "unknown kind",
+			objects: filepath.Join(testdata, "unknown-kind.yaml"),
+			wantErr: `failed to decode object in testdata/render/unknown-kind.yaml: no kind "Widget" is registered`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			renderPodFile = filepath.Join(testdata, "pod.yaml")
+			renderInitializersPath = filepath.Join(testdata, "initializers")
+			renderObjectsPath = tc.objects
+			out := &bytes.Buffer{}
+			CmdRender.SetOut(out)
+			defer CmdRender.SetOut(nil)
+
+			err := render(CmdRender, nil)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, podYAML, ok := strings.Cut(out.String(), "---\n# Patched pod\n")
+			if !ok {
+				t.Fatalf("expected the patched pod in the output, got:\n%s", out)
+			}
+			pod := &corev1.Pod{}
+			if err = yaml.Unmarshal([]byte(podYAML), pod); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.wantInitContainers, initContainerNames(pod)); diff != "" {
+				t.Errorf("unexpected init containers (-want +got):\n%s", diff)
+			}
+			for _, c := range pod.Spec.InitContainers {
+				if len(c.Env) == 0 || c.Env[0].Name != "PVC_1_MOUNT_PATH" {
+					t.Errorf("expected PVC_1_MOUNT_PATH in the environment of init container %s, got %v", c.Name, c.Env)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,670 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	secretKeyCACert     = "ca.crt"
+	secretKeyCAKey      = "ca.key"
+	secretKeyNextCACert = "next-ca.crt"
+	secretKeyNextCAKey  = "next-ca.key"
+
+	caValidity          = 10 * 365 * 24 * time.Hour
+	servingCertValidity = 365 * 24 * time.Hour
+	// certificates are renewed this long before they expire
+	certRenewBefore = 30 * 24 * time.Hour
+	// certificates are valid from this long before they are issued, for clocks which are behind
+	certBackdate = time.Hour
+	// caPropagationDelay is how long a new CA is in the caBundles before it signs the serving certificate,
+	// so that all API servers trust it by then
+	caPropagationDelay = 5 * certCheckInterval
+	// certCheckInterval is how often the Secret, the certificate files and the caBundles are reconciled
+	certCheckInterval = time.Minute
+)
+
+// selfManagedCerts generates the CA and the serving certificate of the webhook, and renews them before they expire.
+// They are stored in a Secret, so that all replicas serve certificates signed by the same CA. The serving certificate
+// is written to certDir for the CertWatcher, and the CA is injected into the caBundle of the webhook configurations,
+// and of the conversion webhook of the Initializer CRD if any.
+type selfManagedCerts struct {
+	client client.Client
+
+	namespace         string
+	secretName        string
+	serviceName       string
+	webhookConfigName string
+	certDir           string
+
+	// certWatcher is told to reload the certificate once it's rotated, may be nil.
+	certWatcher *CertWatcher
+}
+
+func newSelfManagedCerts(cfg *rest.Config, namespace, secretName, serviceName, webhookConfigName, certDir string) (*selfManagedCerts, error) {
+	c, err := client.New(cfg, client.Options{
+		Scheme: scheme,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" {
+		namespace = defaultNamespace()
+	}
+	return &selfManagedCerts{
+		client:            c,
+		namespace:         namespace,
+		secretName:        secretName,
+		serviceName:       serviceName,
+		webhookConfigName: webhookConfigName,
+		certDir:           certDir,
+	}, nil
+}
+
+func (m *selfManagedCerts) certFile() string {
+	return filepath.Join(m.certDir, corev1.TLSCertKey)
+}
+
+func (m *selfManagedCerts) keyFile() string {
+	return filepath.Join(m.certDir, corev1.TLSPrivateKeyKey)
+}
+
+func (m *selfManagedCerts) dnsNames() []string {
+	return []string{
+		m.serviceName,
+		fmt.Sprintf("%s.%s", m.serviceName, m.namespace),
+		fmt.Sprintf("%s.%s.svc", m.serviceName, m.namespace),
+	}
+}
+
+// Bootstrap reconciles until the certificate files are written, so that the CertWatcher can be created.
+func (m *selfManagedCerts) Bootstrap(ctx context.Context) error {
+	return wait.PollUntilContextTimeout(ctx, 2*time.Second, time.Minute, true, func(ctx context.Context) (bool, error) {
+		if err := m.reconcile(ctx); err != nil {
+			klog.ErrorS(err, "failed to reconcile self-managed certificates, will retry")
+			return false, nil
+		}
+		return true, nil
+	})
+}
+
+// Start reconciles periodically until the context is done.
+func (m *selfManagedCerts) Start(ctx context.Context) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := m.reconcile(ctx); err != nil {
+			klog.ErrorS(err, "failed to reconcile self-managed certificates")
+		}
+	}, certCheckInterval)
+}
+
+func (m *selfManagedCerts) reconcile(ctx context.Context) error {
+	bundle, err := m.ensureSecret(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to ensure secret %s/%s: %w", m.namespace, m.secretName, err)
+	}
+	// the caBundles must trust the serving certificate before it's served
+	if err = m.injectCABundle(ctx, bundle.caBundlePEM); err != nil {
+		return err
+	}
+	changed, err := m.writeCertFiles(bundle)
+	if err != nil {
+		return fmt.Errorf("failed to write certificate files: %w", err)
+	}
+	if changed && m.certWatcher != nil {
+		return m.certWatcher.ReadCertificate()
+	}
+	return nil
+}
+
+// ensureSecret returns the certificates in the Secret, which is created if it doesn't exist,
+// and updated if the certificates need to be renewed.
+func (m *selfManagedCerts) ensureSecret(ctx context.Context) (*certBundle, error) {
+	now := time.Now()
+	secret := &corev1.Secret{}
+	err := m.client.Get(ctx, types.NamespacedName{Namespace: m.namespace, Name: m.secretName}, secret)
+	if errors.IsNotFound(err) {
+		bundle, err := newCertBundle(nil, m.dnsNames(), now)
+		if err != nil {
+			return nil, err
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: m.namespace,
+				Name:      m.secretName,
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: bundle.secretData(),
+		}
+		if err = m.client.Create(ctx, secret); err != nil {
+			// another replica may have created it, use its certificates next time
+			return nil, err
+		}
+		klog.Infof("Created secret %s/%s with a new CA and serving certificate", m.namespace, m.secretName)
+		return bundle, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	prev, err := parseCertBundle(secret.Data)
+	var bundle *certBundle
+	if err != nil {
+		klog.ErrorS(err, "invalid certificates in secret, regenerate them", "secret", klog.KObj(secret))
+		if bundle, err = newCertBundle(nil, m.dnsNames(), now); err != nil {
+			return nil, err
+		}
+	} else {
+		nextCATrusted, err := m.nextCATrusted(ctx, prev, now)
+		if err != nil {
+			return nil, err
+		}
+		var reason string
+		if bundle, reason, err = prev.nextCertBundle(m.dnsNames(), now, nextCATrusted); err != nil {
+			return nil, err
+		}
+		if bundle == nil {
+			return prev, nil
+		}
+		klog.Infof("Renew the certificates in secret %s/%s: %s", m.namespace, m.secretName, reason)
+	}
+
+	secret.Data = bundle.secretData()
+	// a conflict means another replica renewed them, use its certificates next time
+	if err = m.client.Update(ctx, secret); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// writeCertFiles writes the serving certificate and key to certDir, and returns whether they changed.
+func (m *selfManagedCerts) writeCertFiles(bundle *certBundle) (bool, error) {
+	if err := os.MkdirAll(m.certDir, 0o700); err != nil {
+		return false, err
+	}
+	certChanged, err := writeFileIfChanged(m.certFile(), bundle.certPEM)
+	if err != nil {
+		return false, err
+	}
+	keyChanged, err := writeFileIfChanged(m.keyFile(), bundle.keyPEM)
+	if err != nil {
+		return false, err
+	}
+	return certChanged || keyChanged, nil
+}
+
+func writeFileIfChanged(path string, data []byte) (bool, error) {
+	existing, err := os.ReadFile(path)
+	if err == nil && bytes.Equal(existing, data) {
+		return false, nil
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp, path)
+}
+
+// nextCATrusted returns whether the next CA of bundle may sign the serving certificate: the caBundles of the webhooks
+// must have it, and must have had it for caPropagationDelay so that all API servers picked them up.
+func (m *selfManagedCerts) nextCATrusted(ctx context.Context, bundle *certBundle, now time.Time) (bool, error) {
+	if bundle.nextCACert == nil || now.Before(bundle.nextCACert.NotBefore.Add(certBackdate+caPropagationDelay)) {
+		return false, nil
+	}
+	caBundles, err := m.injectedCABundles(ctx)
+	if err != nil {
+		return false, err
+	}
+	nextCAPEM := encodeCertificate(bundle.nextCACert)
+	for _, caBundle := range caBundles {
+		if !bytes.Contains(caBundle, nextCAPEM) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// injectedCABundles returns the caBundles of the webhooks served by the service, see injectCABundle.
+func (m *selfManagedCerts) injectedCABundles(ctx context.Context) ([][]byte, error) {
+	matchesService := func(service *admissionregistrationv1.ServiceReference) bool {
+		return service != nil && service.Name == m.serviceName && service.Namespace == m.namespace
+	}
+
+	var caBundles [][]byte
+	mutating := &admissionregistrationv1.MutatingWebhookConfiguration{}
+	if err := m.client.Get(ctx, types.NamespacedName{Name: m.webhookConfigName}, mutating); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	for _, webhook := range mutating.Webhooks {
+		if matchesService(webhook.ClientConfig.Service) {
+			caBundles = append(caBundles, webhook.ClientConfig.CABundle)
+		}
+	}
+	validating := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+	if err := m.client.Get(ctx, types.NamespacedName{Name: m.webhookConfigName}, validating); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	for _, webhook := range validating.Webhooks {
+		if matchesService(webhook.ClientConfig.Service) {
+			caBundles = append(caBundles, webhook.ClientConfig.CABundle)
+		}
+	}
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := m.client.Get(ctx, types.NamespacedName{Name: crdInitializersName}, crd); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	if conversion := crd.Spec.Conversion; conversion != nil && conversion.Strategy == apiextensionsv1.WebhookConverter &&
+		conversion.Webhook != nil && conversion.Webhook.ClientConfig != nil {
+		if cc := conversion.Webhook.ClientConfig; cc.Service != nil && cc.Service.Name == m.serviceName && cc.Service.Namespace == m.namespace {
+			caBundles = append(caBundles, cc.CABundle)
+		}
+	}
+	return caBundles, nil
+}
+
+// injectCABundle sets the caBundle of the webhooks served by the service in the webhook configurations,
+// and of the conversion webhook of the Initializer CRD.
+func (m *selfManagedCerts) injectCABundle(ctx context.Context, caBundle []byte) error {
+	matchesService := func(name, namespace string) bool {
+		return name == m.serviceName && namespace == m.namespace
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		config := &admissionregistrationv1.MutatingWebhookConfiguration{}
+		if err := m.client.Get(ctx, types.NamespacedName{Name: m.webhookConfigName}, config); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		changed := false
+		for i := range config.Webhooks {
+			cc := &config.Webhooks[i].ClientConfig
+			if cc.Service != nil && matchesService(cc.Service.Name, cc.Service.Namespace) && !bytes.Equal(cc.CABundle, caBundle) {
+				cc.CABundle = caBundle
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+		klog.Infof("Inject caBundle into MutatingWebhookConfiguration %s", config.Name)
+		return m.client.Update(ctx, config)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to inject caBundle into MutatingWebhookConfiguration %s: %w", m.webhookConfigName, err)
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		config := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+		if err := m.client.Get(ctx, types.NamespacedName{Name: m.webhookConfigName}, config); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		changed := false
+		for i := range config.Webhooks {
+			cc := &config.Webhooks[i].ClientConfig
+			if cc.Service != nil && matchesService(cc.Service.Name, cc.Service.Namespace) && !bytes.Equal(cc.CABundle, caBundle) {
+				cc.CABundle = caBundle
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+		klog.Infof("Inject caBundle into ValidatingWebhookConfiguration %s", config.Name)
+		return m.client.Update(ctx, config)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to inject caBundle into ValidatingWebhookConfiguration %s: %w", m.webhookConfigName, err)
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := m.client.Get(ctx, types.NamespacedName{Name: crdInitializersName}, crd); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		conversion := crd.Spec.Conversion
+		if conversion == nil || conversion.Strategy != apiextensionsv1.WebhookConverter ||
+			conversion.Webhook == nil || conversion.Webhook.ClientConfig == nil {
+			return nil
+		}
+		cc := conversion.Webhook.ClientConfig
+		if cc.Service == nil || !matchesService(cc.Service.Name, cc.Service.Namespace) || bytes.Equal(cc.CABundle, caBundle) {
+			return nil
+		}
+		cc.CABundle = caBundle
+		klog.Infof("Inject caBundle into the conversion webhook of CustomResourceDefinition %s", crd.Name)
+		return m.client.Update(ctx, crd)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to inject caBundle into CustomResourceDefinition %s: %w", crdInitializersName, err)
+	}
+	return nil
+}
+
+// certBundle is a CA along with a serving certificate it signs, and the CA which replaces it if it's being rotated.
+type certBundle struct {
+	caCert *x509.Certificate
+	caKey  crypto.Signer
+	cert   *x509.Certificate
+	// nextCACert is in the caBundle but doesn't sign the serving certificate yet, may be nil.
+	nextCACert *x509.Certificate
+	nextCAKey  crypto.Signer
+
+	// caBundlePEM is the CA, followed by the next CA and by the previous CA until it expires,
+	// so that clients trust the serving certificates of all replicas while they are being rotated.
+	caBundlePEM   []byte
+	caKeyPEM      []byte
+	certPEM       []byte
+	keyPEM        []byte
+	nextCACertPEM []byte
+	nextCAKeyPEM  []byte
+}
+
+func (b *certBundle) secretData() map[string][]byte {
+	data := map[string][]byte{
+		secretKeyCACert:         b.caBundlePEM,
+		secretKeyCAKey:          b.caKeyPEM,
+		corev1.TLSCertKey:       b.certPEM,
+		corev1.TLSPrivateKeyKey: b.keyPEM,
+	}
+	if b.nextCACert != nil {
+		data[secretKeyNextCACert] = b.nextCACertPEM
+		data[secretKeyNextCAKey] = b.nextCAKeyPEM
+	}
+	return data
+}
+
+func parseCertBundle(data map[string][]byte) (*certBundle, error) {
+	b := &certBundle{
+		caBundlePEM: data[secretKeyCACert],
+		caKeyPEM:    data[secretKeyCAKey],
+		certPEM:     data[corev1.TLSCertKey],
+		keyPEM:      data[corev1.TLSPrivateKeyKey],
+	}
+	caCerts, err := parseCertificates(b.caBundlePEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", secretKeyCACert, err)
+	}
+	b.caCert = caCerts[0]
+	if b.caKey, err = parsePrivateKey(b.caKeyPEM); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", secretKeyCAKey, err)
+	}
+	certs, err := parseCertificates(b.certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", corev1.TLSCertKey, err)
+	}
+	b.cert = certs[0]
+	if _, err = parsePrivateKey(b.keyPEM); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", corev1.TLSPrivateKeyKey, err)
+	}
+
+	if _, ok := data[secretKeyNextCACert]; !ok {
+		return b, nil
+	}
+	b.nextCACertPEM, b.nextCAKeyPEM = data[secretKeyNextCACert], data[secretKeyNextCAKey]
+	if certs, err = parseCertificates(b.nextCACertPEM); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", secretKeyNextCACert, err)
+	}
+	b.nextCACert = certs[0]
+	if b.nextCAKey, err = parsePrivateKey(b.nextCAKeyPEM); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", secretKeyNextCAKey, err)
+	}
+	return b, nil
+}
+
+// nextCertBundle returns the certificates which replace b and why, nil if b doesn't need to change.
+// The CA is rotated in two phases, so that the serving certificate is never signed by a CA the clients don't trust yet:
+// a new CA is added to the caBundle first, and only signs the serving certificate once nextCATrusted.
+// The old CA stays in the caBundle until it expires.
+func (b *certBundle) nextCertBundle(dnsNames []string, now time.Time, nextCATrusted bool) (*certBundle, string, error) {
+	switch {
+	case !now.Before(b.caCert.NotAfter):
+		// too late to rotate it without an outage
+		bundle, err := newCertBundle(nil, dnsNames, now)
+		return bundle, fmt.Sprintf("CA expired at %s", b.caCert.NotAfter), err
+	case b.nextCACert != nil && nextCATrusted:
+		bundle, err := b.promoteNextCA(dnsNames, now)
+		return bundle, "the new CA is trusted, it signs the serving certificate from now on", err
+	case b.nextCACert == nil && now.Add(certRenewBefore).After(b.caCert.NotAfter):
+		bundle, err := b.withNextCA(now)
+		return bundle, fmt.Sprintf("CA expires at %s, add a new CA to the caBundle", b.caCert.NotAfter), err
+	}
+	if reason := b.renewalReason(dnsNames, now); reason != "" {
+		bundle, err := newCertBundle(b, dnsNames, now)
+		return bundle, reason, err
+	}
+	return nil, "", nil
+}
+
+// renewalReason returns why the serving certificate needs to be renewed, empty if it doesn't.
+// A serving certificate which expires along with its CA is renewed when the CA is rotated.
+func (b *certBundle) renewalReason(dnsNames []string, now time.Time) string {
+	switch {
+	case now.Add(certRenewBefore).After(b.cert.NotAfter) && b.cert.NotAfter.Before(b.caCert.NotAfter):
+		return fmt.Sprintf("serving certificate expires at %s", b.cert.NotAfter)
+	case b.cert.CheckSignatureFrom(b.caCert) != nil:
+		return "serving certificate is not signed by the CA"
+	}
+	if _, err := tls.X509KeyPair(b.certPEM, b.keyPEM); err != nil {
+		return "serving certificate does not match its key"
+	}
+	for _, name := range dnsNames {
+		if !slices.Contains(b.cert.DNSNames, name) {
+			return fmt.Sprintf("serving certificate is not valid for %s", name)
+		}
+	}
+	return ""
+}
+
+// newCertBundle issues a new serving certificate for dnsNames. It's signed by the CA of prev,
+// or by a new CA if prev is nil.
+func newCertBundle(prev *certBundle, dnsNames []string, now time.Time) (*certBundle, error) {
+	b := &certBundle{}
+	if prev != nil {
+		*b = *prev
+	} else {
+		caCert, caKey, caKeyPEM, err := newCA(now)
+		if err != nil {
+			return nil, err
+		}
+		b.caCert, b.caKey, b.caKeyPEM = caCert, caKey, caKeyPEM
+	}
+	b.setCABundle(prev, now)
+	if err := b.issueServingCert(dnsNames, now); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// withNextCA returns b with a new CA added to the caBundle, which doesn't sign the serving certificate yet.
+func (b *certBundle) withNextCA(now time.Time) (*certBundle, error) {
+	nextCACert, nextCAKey, nextCAKeyPEM, err := newCA(now)
+	if err != nil {
+		return nil, err
+	}
+	next := *b
+	next.nextCACert, next.nextCAKey = nextCACert, nextCAKey
+	next.nextCACertPEM, next.nextCAKeyPEM = encodeCertificate(nextCACert), nextCAKeyPEM
+	next.setCABundle(b, now)
+	return &next, nil
+}
+
+// promoteNextCA returns the next CA of b along with a new serving certificate it signs.
+func (b *certBundle) promoteNextCA(dnsNames []string, now time.Time) (*certBundle, error) {
+	next := &certBundle{
+		caCert:   b.nextCACert,
+		caKey:    b.nextCAKey,
+		caKeyPEM: b.nextCAKeyPEM,
+	}
+	next.setCABundle(b, now)
+	if err := next.issueServingCert(dnsNames, now); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// setCABundle sets the caBundle to the CA and the next CA, followed by the CAs in the caBundle of prev which haven't expired.
+func (b *certBundle) setCABundle(prev *certBundle, now time.Time) {
+	b.caBundlePEM = encodeCertificate(b.caCert)
+	if b.nextCACert != nil {
+		b.caBundlePEM = append(b.caBundlePEM, b.nextCACertPEM...)
+	}
+	if prev == nil {
+		return
+	}
+	caCerts, _ := parseCertificates(prev.caBundlePEM)
+	for _, c := range caCerts {
+		if now.Before(c.NotAfter) && !c.Equal(b.caCert) && (b.nextCACert == nil || !c.Equal(b.nextCACert)) {
+			b.caBundlePEM = append(b.caBundlePEM, encodeCertificate(c)...)
+		}
+	}
+}
+
+// issueServingCert issues a serving certificate for dnsNames signed by the CA, which doesn't outlive it.
+func (b *certBundle) issueServingCert(dnsNames []string, now time.Time) error {
+	key, keyPEM, err := generatePrivateKey()
+	if err != nil {
+		return err
+	}
+	notAfter := now.Add(servingCertValidity)
+	if notAfter.After(b.caCert.NotAfter) {
+		notAfter = b.caCert.NotAfter
+	}
+	cert, err := createCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: dnsNames[len(dnsNames)-1]},
+		DNSNames:    dnsNames,
+		NotBefore:   now.Add(-certBackdate),
+		NotAfter:    notAfter,
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, b.caCert, key, b.caKey)
+	if err != nil {
+		return err
+	}
+	b.cert = cert
+	b.certPEM = encodeCertificate(cert)
+	b.keyPEM = keyPEM
+	return nil
+}
+
+// newCA generates a self-signed CA, valid from certBackdate before now.
+func newCA(now time.Time) (*x509.Certificate, crypto.Signer, []byte, error) {
+	caKey, caKeyPEM, err := generatePrivateKey()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	caCert, err := createCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("volume-initializer-ca@%d", now.Unix())},
+		NotBefore:             now.Add(-certBackdate),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, caKey, caKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return caCert, caKey, caKeyPEM, nil
+}
+
+// createCertificate creates a certificate from template for key, signed by parent with parentKey,
+// the certificate is self-signed if parent is nil.
+func createCertificate(template, parent *x509.Certificate, key, parentKey crypto.Signer) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serial
+	if parent == nil {
+		parent = template
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+func generatePrivateKey() (crypto.Signer, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	return certs, nil
+}
+
+func encodeCertificate(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
@@ -0,0 +1,231 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCertBundleRotation(t *testing.T) {
+	dnsNames := []string{"volume-initializer", "volume-initializer.default", "volume-initializer.default.svc"}
+	now := time.Now()
+
+	bundle, err := newCertBundle(nil, dnsNames, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parseCertBundle(bundle.secretData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tls.X509KeyPair(parsed.certPEM, parsed.keyPEM); err != nil {
+		t.Fatalf("serving certificate and key don't match: %v", err)
+	}
+	if next, reason, _ := parsed.nextCertBundle(dnsNames, now, false); next != nil {
+		t.Fatalf("expected no renewal for new certificates, got %q", reason)
+	}
+	if next, _, _ := parsed.nextCertBundle(append(dnsNames, "volume-initializer.other.svc"), now, false); next == nil {
+		t.Error("expected renewal for a new DNS name")
+	}
+
+	// the serving certificate expires before the CA, which is kept
+	later := parsed.cert.NotAfter.Add(-certRenewBefore / 2)
+	renewed, _, err := parsed.nextCertBundle(dnsNames, later, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed == nil {
+		t.Fatal("expected renewal for the expiring serving certificate")
+	}
+	if !renewed.caCert.Equal(parsed.caCert) || !bytes.Equal(renewed.caBundlePEM, parsed.caBundlePEM) {
+		t.Error("expected the CA to be kept")
+	}
+	if renewed.cert.Equal(parsed.cert) {
+		t.Error("expected a new serving certificate")
+	}
+	if next, reason, _ := renewed.nextCertBundle(dnsNames, later, false); next != nil {
+		t.Errorf("expected no renewal for renewed certificates, got %q", reason)
+	}
+
+	// a serving certificate which expires along with the CA waits for the CA rotation
+	later = parsed.caCert.NotAfter.Add(-certRenewBefore - time.Hour)
+	if renewed, err = newCertBundle(renewed, dnsNames, later); err != nil {
+		t.Fatal(err)
+	}
+	if !renewed.cert.NotAfter.Equal(renewed.caCert.NotAfter) {
+		t.Fatalf("expected the serving certificate to expire along with the CA")
+	}
+	if next, reason, _ := renewed.nextCertBundle(dnsNames, later, false); next != nil {
+		t.Errorf("expected no renewal before the CA rotation, got %q", reason)
+	}
+
+	// the CA expires, a new one is added to the bundle, but doesn't sign the serving certificate yet
+	later = parsed.caCert.NotAfter.Add(-certRenewBefore / 2)
+	staged, _, err := renewed.nextCertBundle(dnsNames, later, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if staged == nil || staged.nextCACert == nil {
+		t.Fatal("expected a new CA for the expiring CA")
+	}
+	if staged, err = parseCertBundle(staged.secretData()); err != nil {
+		t.Fatal(err)
+	}
+	if !staged.caCert.Equal(renewed.caCert) || !staged.cert.Equal(renewed.cert) {
+		t.Error("expected the CA and the serving certificate to be kept until the new CA is trusted")
+	}
+	caCerts, err := parseCertificates(staged.caBundlePEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(caCerts) != 2 || !caCerts[0].Equal(renewed.caCert) || !caCerts[1].Equal(staged.nextCACert) {
+		t.Errorf("expected the CA followed by the new one in the bundle, got %d CAs", len(caCerts))
+	}
+	if next, reason, _ := staged.nextCertBundle(dnsNames, later, false); next != nil {
+		t.Errorf("expected no renewal until the new CA is trusted, got %q", reason)
+	}
+
+	// the new CA is trusted, it signs the serving certificate and the old one stays in the bundle until it expires
+	rotated, _, err := staged.nextCertBundle(dnsNames, later, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated == nil || !rotated.caCert.Equal(staged.nextCACert) || rotated.nextCACert != nil {
+		t.Fatal("expected the new CA to replace the old one")
+	}
+	if caCerts, err = parseCertificates(rotated.caBundlePEM); err != nil {
+		t.Fatal(err)
+	}
+	if len(caCerts) != 2 || !caCerts[0].Equal(rotated.caCert) || !caCerts[1].Equal(renewed.caCert) {
+		t.Errorf("expected the new CA followed by the old one in the bundle, got %d CAs", len(caCerts))
+	}
+	if err = rotated.cert.CheckSignatureFrom(rotated.caCert); err != nil {
+		t.Errorf("expected the serving certificate to be signed by the new CA: %v", err)
+	}
+
+	// the old CA is dropped once expired
+	rerotated, err := newCertBundle(rotated, dnsNames, renewed.caCert.NotAfter.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caCerts, _ = parseCertificates(rerotated.caBundlePEM); len(caCerts) != 1 {
+		t.Errorf("expected the expired CA to be dropped, got %d CAs", len(caCerts))
+	}
+
+	// a CA which expired anyway is replaced right away
+	expired, _, err := staged.nextCertBundle(dnsNames, staged.caCert.NotAfter, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired == nil || expired.caCert.Equal(staged.caCert) || expired.nextCACert != nil {
+		t.Error("expected a new CA for the expired CA")
+	}
+}
+
+func TestCertBundleMismatchedKey(t *testing.T) {
+	dnsNames := []string{"volume-initializer"}
+	now := time.Now()
+	bundle, err := newCertBundle(nil, dnsNames, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := newCertBundle(nil, dnsNames, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// e.g. the Secret was edited by hand
+	data := bundle.secretData()
+	data[corev1.TLSPrivateKeyKey] = other.keyPEM
+	parsed, err := parseCertBundle(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renewed, reason, err := parsed.nextCertBundle(dnsNames, now, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason != "serving certificate does not match its key" {
+		t.Errorf("unexpected renewal reason %q", reason)
+	}
+	if renewed == nil {
+		t.Fatal("expected renewal for a serving certificate which doesn't match its key")
+	}
+	if _, err = tls.X509KeyPair(renewed.certPEM, renewed.keyPEM); err != nil {
+		t.Errorf("renewed serving certificate and key don't match: %v", err)
+	}
+	if !renewed.caCert.Equal(bundle.caCert) {
+		t.Error("expected the CA to be kept")
+	}
+}
+
+func TestNextCATrusted(t *testing.T) {
+	now := time.Now()
+	bundle, err := newCertBundle(nil, []string{"volume-initializer"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle, err = bundle.withNextCA(now); err != nil {
+		t.Fatal(err)
+	}
+	config := func(caBundle []byte) *admissionregistrationv1.MutatingWebhookConfiguration {
+		return &admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "volume-initializer"},
+			Webhooks: []admissionregistrationv1.MutatingWebhook{{
+				Name: "pods.storage.kubesphere.io",
+				ClientConfig: admissionregistrationv1.WebhookClientConfig{
+					Service:  &admissionregistrationv1.ServiceReference{Namespace: "default", Name: "volume-initializer"},
+					CABundle: caBundle,
+				},
+			}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		config  *admissionregistrationv1.MutatingWebhookConfiguration
+		at      time.Time
+		trusted bool
+	}{
+		{
+			name:   "caBundle has the next CA, but not for long enough",
+			config: config(bundle.caBundlePEM),
+			at:     now.Add(caPropagationDelay / 2),
+		},
+		{
+			name:    "caBundle has had the next CA for long enough",
+			config:  config(bundle.caBundlePEM),
+			at:      now.Add(caPropagationDelay),
+			trusted: true,
+		},
+		{
+			name:   "caBundle doesn't have the next CA",
+			config: config(encodeCertificate(bundle.caCert)),
+			at:     now.Add(caPropagationDelay),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &selfManagedCerts{
+				client:            fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.config).Build(),
+				namespace:         "default",
+				serviceName:       "volume-initializer",
+				webhookConfigName: "volume-initializer",
+			}
+			trusted, err := m.nextCATrusted(context.Background(), bundle, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if trusted != tt.trusted {
+				t.Errorf("expected trusted %v, got %v", tt.trusted, trusted)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// MissingPVCPolicy decides what to do with a volume whose PVC neither exists nor can be synthesized.
+type MissingPVCPolicy string
+
+const (
+	// MissingPVCPolicyDeny denies the pod if a PVCInitializer which may match the volume has failurePolicy "Fail",
+	// see pvcLookupFailed.
+	MissingPVCPolicyDeny MissingPVCPolicy = "Deny"
+	// MissingPVCPolicySkip skips the volume, no init container is injected for it.
+	MissingPVCPolicySkip MissingPVCPolicy = "Skip"
+)
+
+const annotationIsDefaultStorageClass = "storageclass.kubernetes.io/is-default-class"
+
+// getPVC returns the PVC of the volume. If the PVC doesn't exist yet, e.g. the pod is a new replica of a StatefulSet,
+// the PVC is synthesized from the matching volumeClaimTemplate of the StatefulSet owning the pod, the same way
+// as the StatefulSet controller will create it. A NotFound error is returned if the PVC can't be synthesized either.
+func (a *Admitter) getPVC(ctx context.Context, reqInfo *ReqInfo, claimName string) (*corev1.PersistentVolumeClaim, error) {
+	pod := reqInfo.Pod
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := a.client.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: claimName}, pvc)
+	if err == nil {
+		return pvc, nil
+	}
+	if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	synthesized, synthesizeErr := a.synthesizePVCFromStatefulSet(ctx, reqInfo, claimName)
+	if synthesizeErr != nil {
+		return nil, synthesizeErr
+	}
+	if synthesized == nil {
+		return nil, err
+	}
+	// the usual case for a new replica, only degraded synthesized PVCs are warned about
+	klog.V(2).Infof("pvc %s of pod %s not found, it's evaluated as synthesized from the volumeClaimTemplates of the owning StatefulSet",
+		claimName, podDisplayName(pod))
+	return synthesized, nil
+}
+
+// synthesizePVCFromStatefulSet returns the PVC the StatefulSet owning the pod will create for claimName,
+// nil is returned if the pod is not owned by a StatefulSet or claimName doesn't come from its volumeClaimTemplates.
+func (a *Admitter) synthesizePVCFromStatefulSet(ctx context.Context, reqInfo *ReqInfo, claimName string) (*corev1.PersistentVolumeClaim, error) {
+	pod := reqInfo.Pod
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "StatefulSet" || owner.APIVersion != appsv1.SchemeGroupVersion.String() {
+		return nil, nil
+	}
+	// the StatefulSet controller always names the pod, which the PVC names derive from
+	if pod.Name == "" {
+		return nil, nil
+	}
+
+	sts := &appsv1.StatefulSet{}
+	err := a.client.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: owner.Name}, sts)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for _, template := range sts.Spec.VolumeClaimTemplates {
+		// the PVC is named <template>-<statefulset>-<ordinal> and the pod <statefulset>-<ordinal>
+		if fmt.Sprintf("%s-%s", template.Name, pod.Name) != claimName {
+			continue
+		}
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        claimName,
+				Namespace:   pod.Namespace,
+				Labels:      map[string]string{},
+				Annotations: template.Annotations,
+			},
+			Spec: *template.Spec.DeepCopy(),
+		}
+		for k, v := range template.Labels {
+			pvc.Labels[k] = v
+		}
+		if sts.Spec.Selector != nil {
+			for k, v := range sts.Spec.Selector.MatchLabels {
+				pvc.Labels[k] = v
+			}
+		}
+		if pvc.Spec.StorageClassName == nil {
+			pvc.Spec.StorageClassName, err = a.getDefaultStorageClassName(ctx, reqInfo, "pvc "+claimName)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return pvc, nil
+	}
+	return nil, nil
+}
+
+// getDefaultStorageClassName returns the name of the default StorageClass, which the DefaultStorageClass
+// admission plugin will set on the synthesized PVC described by pvcDesc, which has no storageClassName. nil is returned
+// with a warning if there is no default StorageClass, so the PVC doesn't match StorageClass selectors.
+func (a *Admitter) getDefaultStorageClassName(ctx context.Context, reqInfo *ReqInfo, pvcDesc string) (*string, error) {
+	scList := &storagev1.StorageClassList{}
+	err := a.client.List(ctx, scList)
+	if err != nil {
+		return nil, err
+	}
+	var defaultSC *storagev1.StorageClass
+	for i := range scList.Items {
+		sc := &scList.Items[i]
+		if sc.Annotations[annotationIsDefaultStorageClass] != "true" {
+			continue
+		}
+		// the newest default StorageClass is used if there are multiple ones
+		if defaultSC == nil || defaultSC.CreationTimestamp.Before(&sc.CreationTimestamp) {
+			defaultSC = sc
+		}
+	}
+	if defaultSC == nil {
+		reqInfo.warn("no default StorageClass, %s is evaluated without a storageClassName", pvcDesc)
+		return nil, nil
+	}
+	return &defaultSC.Name, nil
+}
@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/klog/v2"
+)
+
+// tlsVersions are the values of --tls-min-version, named like the flag of the same name of kube-apiserver.
+var tlsVersions = map[string]uint16{
+	"VersionTLS10": tls.VersionTLS10,
+	"VersionTLS11": tls.VersionTLS11,
+	"VersionTLS12": tls.VersionTLS12,
+	"VersionTLS13": tls.VersionTLS13,
+}
+
+func parseTLSVersion(name string) (uint16, error) {
+	if v, ok := tlsVersions[name]; ok {
+		return v, nil
+	}
+	names := make([]string, 0, len(tlsVersions))
+	for n := range tlsVersions {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return 0, fmt.Errorf("unsupported TLS version %q, must be one of %s", name, strings.Join(names, ", "))
+}
+
+// parseCipherSuites returns the IDs of the named cipher suites. Only the cipher suites Go considers secure are accepted.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	suites := map[string]uint16{}
+	for _, s := range tls.CipherSuites() {
+		suites[s.Name] = s.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, n := range names {
+		id, ok := suites[n]
+		if !ok {
+			return nil, fmt.Errorf("unsupported cipher suite %q", n)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// newTLSConfig returns the TLS config of the webhook server, serving the certificate of cw.
+// If caw is not nil, client certificates are verified against its CA bundle, which is picked up on every handshake
+// so that it can be reloaded. Whether they are required is up to the handlers, see requireClientCert.
+func newTLSConfig(cw *CertWatcher, caw *ClientCAWatcher, minVersion string, cipherSuites []string) (*tls.Config, error) {
+	version, err := parseTLSVersion(minVersion)
+	if err != nil {
+		return nil, err
+	}
+	suites, err := parseCipherSuites(cipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	if version == tls.VersionTLS13 && len(suites) > 0 {
+		klog.Warning("--tls-cipher-suites is ignored by TLS 1.3, which is the minimum TLS version")
+	}
+	cfg := &tls.Config{
+		GetCertificate: cw.GetCertificate,
+		MinVersion:     version,
+		CipherSuites:   suites,
+	}
+	if caw != nil {
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c := cfg.Clone()
+			c.GetConfigForClient = nil
+			c.ClientCAs = caw.Pool()
+			return c, nil
+		}
+	}
+	return cfg, nil
+}
+
+// requireClientCert rejects requests without a client certificate verified against --client-ca-file, if it's set.
+func requireClientCert(next http.HandlerFunc) http.HandlerFunc {
+	if clientCAFile == "" {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			klog.Warningf("rejected request to %s from %s without a verified client certificate", r.URL.Path, r.RemoteAddr)
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// ClientCAWatcher watches a CA bundle file for changes, and keeps a pool of its certificates
+// to verify client certificates against.
+type ClientCAWatcher struct {
+	sync.Mutex
+
+	pool *x509.CertPool
+	// caPEM is the content of the file pool was loaded from
+	caPEM []byte
+
+	watcher      *fsnotify.Watcher
+	pollInterval time.Duration
+
+	caPath string
+}
+
+// NewClientCAWatcher returns a new ClientCAWatcher watching the given CA bundle.
+func NewClientCAWatcher(caPath string) (*ClientCAWatcher, error) {
+	var err error
+
+	caw := &ClientCAWatcher{
+		caPath:       caPath,
+		pollInterval: defaultCertPollInterval,
+	}
+
+	// Initial read of the CA bundle.
+	if err := caw.ReadCA(); err != nil {
+		return nil, err
+	}
+
+	caw.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	return caw, nil
+}
+
+// Pool returns the currently loaded CA certificates.
+func (caw *ClientCAWatcher) Pool() *x509.CertPool {
+	caw.Lock()
+	defer caw.Unlock()
+	return caw.pool
+}
+
+// Start starts the watch on the directory of the CA bundle.
+func (caw *ClientCAWatcher) Start(ctx context.Context) error {
+	return watchFiles(ctx, caw.watcher, []string{caw.caPath}, caw.pollInterval, caw.ReadCA)
+}
+
+// ReadCA reads the CA bundle from disk, and updates the current pool if it changed.
+// The current pool is kept if the file doesn't contain any certificate.
+func (caw *ClientCAWatcher) ReadCA() error {
+	caPEM, err := os.ReadFile(caw.caPath)
+	if err != nil {
+		return err
+	}
+
+	caw.Lock()
+	unchanged := bytes.Equal(caPEM, caw.caPEM)
+	caw.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no certificate found in %s, keep verifying client certificates against the current CA bundle", caw.caPath)
+	}
+
+	caw.Lock()
+	caw.pool = pool
+	caw.caPEM = caPEM
+	caw.Unlock()
+
+	klog.InfoS("Updated client CA bundle", "path", caw.caPath)
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package webhook
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		want    uint16
+		wantErr bool
+	}{
+		{name: "VersionTLS12", want: tls.VersionTLS12},
+		{name: "VersionTLS13", want: tls.VersionTLS13},
+		{name: "TLS12", wantErr: true},
+		{name: "", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseTLSVersion(tc.name)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %t, got %v", tc.wantErr, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected version %#x, got %#x", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		names   []string
+		want    []uint16
+		wantErr bool
+	}{
+		{name: "none"},
+		{
+			name:  "secure",
+			names: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256"},
+			want:  []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256},
+		},
+		{
+			name:    "insecure",
+			names:   []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_RSA_WITH_RC4_128_SHA"},
+			wantErr: true,
+		},
+		{name: "unknown", names: []string{"TLS_NULL_WITH_NULL_NULL"}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseCipherSuites(tc.names)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %t, got %v", tc.wantErr, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected cipher suites (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// newClientCert returns a client certificate signed by a new CA, along with the PEM of the CA.
+func newClientCert(t *testing.T) (tls.Certificate, []byte) {
+	t.Helper()
+	now := time.Now()
+	caCert, caKey, _, err := newCA(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, keyPEM, err := generatePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := createCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "kube-apiserver"},
+		NotBefore:   now.Add(-certBackdate),
+		NotAfter:    now.Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, key, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.X509KeyPair(encodeCertificate(cert), keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair, encodeCertificate(caCert)
+}
+
+func TestRequireClientCert(t *testing.T) {
+	dir := t.TempDir()
+	serving := newTestCertBundle(t)
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "client-ca.crt")
+	trusted, trustedCAPEM := newClientCert(t)
+	untrusted, _ := newClientCert(t)
+	for path, data := range map[string][]byte{certFile: serving.certPEM, keyFile: serving.keyPEM, caFile: trustedCAPEM} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cw, err := NewCertWatcher(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caw, err := NewClientCAWatcher(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCAs := x509.NewCertPool()
+	rootCAs.AppendCertsFromPEM(serving.caBundlePEM)
+
+	defer func(prev string) { clientCAFile = prev }(clientCAFile)
+	for _, tc := range []struct {
+		name         string
+		clientCAFile string
+		clientCert   *tls.Certificate
+		// wantStatus is 0 if the handshake is expected to fail
+		wantStatus int
+	}{
+		{name: "no client CA", wantStatus: http.StatusOK},
+		{name: "no client certificate", clientCAFile: caFile, wantStatus: http.StatusUnauthorized},
+		{name: "trusted client certificate", clientCAFile: caFile, clientCert: &trusted, wantStatus: http.StatusOK},
+		{name: "untrusted client certificate", clientCAFile: caFile, clientCert: &untrusted},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clientCAFile = tc.clientCAFile
+			var serverCAW *ClientCAWatcher
+			if tc.clientCAFile != "" {
+				serverCAW = caw
+			}
+			tlsConfig, err := newTLSConfig(cw, serverCAW, "VersionTLS12", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := httptest.NewUnstartedServer(requireClientCert(func(w http.ResponseWriter, r *http.Request) {}))
+			server.TLS = tlsConfig
+			server.StartTLS()
+			defer server.Close()
+
+			clientTLSConfig := &tls.Config{RootCAs: rootCAs, ServerName: "localhost"}
+			if tc.clientCert != nil {
+				clientTLSConfig.Certificates = []tls.Certificate{*tc.clientCert}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLSConfig}}
+			resp, err := client.Get(server.URL)
+			if tc.wantStatus == 0 {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("expected the handshake to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("expected status %d, got %d", tc.wantStatus, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -4,23 +4,80 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/kubesphere/volume-initializer/pkg/controller"
+	"github.com/kubesphere/volume-initializer/pkg/generated/clientset/versioned"
+	informers "github.com/kubesphere/volume-initializer/pkg/generated/informers/externalversions"
 	"github.com/spf13/cobra"
 	v1 "k8s.io/api/admission/v1"
+	"k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
 var (
-	certFile string
-	keyFile  string
-	port     int
+	certFile               string
+	keyFile                string
+	port                   int
+	healthPort             int
+	enableStatusController bool
+	leaderElect            bool
+	leaderElectionID       string
+	leaderElectionNS       string
+	missingPVCPolicy       string
+	namespacePolicy        string
+	enableDebugExplain     bool
+	readTimeout            time.Duration
+	writeTimeout           time.Duration
+	idleTimeout            time.Duration
+	maxHeaderBytes         int
+	maxRequestBodyBytes    int64
+	maxConcurrentRequests  int
+	shutdownDelay          time.Duration
+	shutdownTimeout        time.Duration
+	selfManagedCertsFlag   bool
+	certDir                string
+	certSecretName         string
+	serviceName            string
+	serviceNamespace       string
+	webhookConfigName      string
+	tlsMinVersion          string
+	tlsCipherSuites        []string
+	clientCAFile           string
 )
 
+var (
+	// inflight limits the number of admission requests served concurrently, nil if there is no limit.
+	inflight chan struct{}
+	// shuttingDown is set once the webhook starts shutting down, so that it's not ready any more.
+	shuttingDown atomic.Bool
+)
+
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
 // CmdWebhook is user by Cobra
 var CmdWebhook = &cobra.Command{
 	Use:  "volume-initializer-webhook",
@@ -30,29 +87,101 @@ var CmdWebhook = &cobra.Command{
 
 func init() {
 	CmdWebhook.Flags().StringVar(&certFile, "tls-cert-file", "",
-		"File containing the x509 Certificate for HTTPS. (CA cert, if any, concatenated after server cert). Required.")
+		"File containing the x509 Certificate for HTTPS. (CA cert, if any, concatenated after server cert). Required unless --self-managed-certs is set.")
 	CmdWebhook.Flags().StringVar(&keyFile, "tls-private-key-file", "",
-		"File containing the x509 private key matching --tls-cert-file. Required.")
+		"File containing the x509 private key matching --tls-cert-file. Required unless --self-managed-certs is set.")
+	CmdWebhook.Flags().StringVar(&tlsMinVersion, "tls-min-version", "VersionTLS12",
+		"Minimum TLS version supported, one of VersionTLS10, VersionTLS11, VersionTLS12, VersionTLS13")
+	CmdWebhook.Flags().StringSliceVar(&tlsCipherSuites, "tls-cipher-suites", nil,
+		"Comma-separated list of cipher suites for TLS 1.2 and below, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. Go defaults if empty")
+	CmdWebhook.Flags().StringVar(&clientCAFile, "client-ca-file", "",
+		"File containing the CA bundle to verify client certificates against. If set, admission requests must present a client certificate signed by it")
+	CmdWebhook.Flags().BoolVar(&selfManagedCertsFlag, "self-managed-certs", false,
+		"Generate and rotate the CA and serving certificate, store them in --cert-secret-name, and inject the CA into the caBundle of the webhook configurations")
+	CmdWebhook.Flags().StringVar(&certDir, "cert-dir", "/tmp/volume-initializer/certs",
+		"Directory the self-managed serving certificate and key are written to")
+	CmdWebhook.Flags().StringVar(&certSecretName, "cert-secret-name", "volume-initializer-certs",
+		"Secret in --service-namespace the self-managed certificates are stored in")
+	CmdWebhook.Flags().StringVar(&serviceName, "service-name", "volume-initializer",
+		"Service of the webhook, which the self-managed serving certificate is issued for")
+	CmdWebhook.Flags().StringVar(&serviceNamespace, "service-namespace", "",
+		"Namespace of the Service of the webhook, defaults to the POD_NAMESPACE environment variable, then to the namespace of the service account")
+	CmdWebhook.Flags().StringVar(&webhookConfigName, "webhook-config-name", "volume-initializer",
+		"MutatingWebhookConfiguration and ValidatingWebhookConfiguration whose webhooks served by --service-name get the self-managed CA injected")
 	CmdWebhook.Flags().IntVar(&port, "port", 443,
 		"Secure port that the webhook listens on")
-	CmdWebhook.MarkFlagRequired("tls-cert-file")
-	CmdWebhook.MarkFlagRequired("tls-private-key-file")
+	CmdWebhook.Flags().IntVar(&healthPort, "health-port", 8081,
+		"Plain HTTP port that /healthz, /readyz and /metrics are served on, 0 to disable")
+	CmdWebhook.Flags().BoolVar(&enableStatusController, "enable-status-controller", true,
+		"Run the controller which keeps the status of Initializers up to date")
+	CmdWebhook.Flags().BoolVar(&leaderElect, "leader-elect", true,
+		"Only run the status controller in the replica holding the --leader-election-id Lease, so that the replicas don't race to update the status")
+	CmdWebhook.Flags().StringVar(&leaderElectionID, "leader-election-id", "volume-initializer-status",
+		"Name of the Lease in --leader-election-namespace the replicas elect the one running the status controller with")
+	CmdWebhook.Flags().StringVar(&leaderElectionNS, "leader-election-namespace", "",
+		"Namespace of the --leader-election-id Lease, defaults to the POD_NAMESPACE environment variable, then to the namespace of the service account")
+	CmdWebhook.Flags().StringVar(&missingPVCPolicy, "missing-pvc-policy", string(MissingPVCPolicyDeny),
+		"What to do with a volume whose PVC neither exists nor can be synthesized from the volumeClaimTemplates of the owning StatefulSet, one of Deny, Skip")
+	CmdWebhook.Flags().StringVar(&namespacePolicy, "namespace-policy", string(NamespacePolicyOptOut),
+		"Which namespaces the pods are evaluated in, one of OptOut (all but the ones labeled storage.kubesphere.io/initializer=disabled), OptIn (only the ones labeled storage.kubesphere.io/initializer=enabled)")
+	CmdWebhook.Flags().BoolVar(&enableDebugExplain, "enable-debug-explain", false,
+		"Serve /debug/explain, which explains how the volumes of the posted pod are evaluated against the Initializers")
+	CmdWebhook.Flags().DurationVar(&readTimeout, "read-timeout", 10*time.Second,
+		"Maximum duration for reading a request, including its body")
+	CmdWebhook.Flags().DurationVar(&writeTimeout, "write-timeout", 30*time.Second,
+		"Maximum duration from the end of reading a request's headers to the end of writing its response")
+	CmdWebhook.Flags().DurationVar(&idleTimeout, "idle-timeout", 120*time.Second,
+		"Maximum duration to wait for the next request on a keep-alive connection")
+	CmdWebhook.Flags().IntVar(&maxHeaderBytes, "max-header-bytes", http.DefaultMaxHeaderBytes,
+		"Maximum size of request headers in bytes")
+	CmdWebhook.Flags().Int64Var(&maxRequestBodyBytes, "max-request-body-bytes", 7<<20,
+		"Maximum size of request bodies in bytes, an AdmissionReview may carry both the object and the old object")
+	CmdWebhook.Flags().IntVar(&maxConcurrentRequests, "max-concurrent-requests", 100,
+		"Maximum number of admission requests served concurrently, pods beyond it are allowed without being processed and Initializers are rejected. 0 for no limit")
+	CmdWebhook.Flags().DurationVar(&shutdownDelay, "shutdown-delay", 5*time.Second,
+		"Duration to keep serving after SIGTERM while not ready, so that the endpoints are updated before the server stops accepting requests")
+	CmdWebhook.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", 20*time.Second,
+		"Maximum duration to wait for in-flight requests to finish on shutdown")
 }
 
-// admitV1beta1Func handles a v1 admission
+// admitV1beta1Func handles a v1beta1 admission
+type admitV1beta1Func func(v1beta1.AdmissionReview) *v1beta1.AdmissionResponse
+
+// admitV1Func handles a v1 admission
 type admitV1Func func(v1.AdmissionReview) *v1.AdmissionResponse
 
 // admitHandler is a handler, for both validators and mutators, that supports multiple admission review versions
 type admitHandler struct {
-	v1 admitV1Func
+	v1beta1 admitV1beta1Func
+	v1      admitV1Func
+	// failOpen allows the requests beyond --max-concurrent-requests without processing them,
+	// otherwise they are rejected with 429 so that the failurePolicy of the webhook applies.
+	failOpen bool
 }
 
 func newDelegateToV1AdmitHandler(f admitV1Func) admitHandler {
-	return admitHandler{v1: f}
+	return admitHandler{
+		v1beta1: delegateV1beta1AdmitToV1(f),
+		v1:      f,
+	}
+}
+
+// delegateV1beta1AdmitToV1 converts v1beta1 admissions to v1 ones and back, so that f serves both versions.
+func delegateV1beta1AdmitToV1(f admitV1Func) admitV1beta1Func {
+	return func(review v1beta1.AdmissionReview) *v1beta1.AdmissionResponse {
+		in := v1.AdmissionReview{Request: convertAdmissionRequestToV1(review.Request)}
+		out := f(in)
+		return convertAdmissionResponseToV1beta1(out)
+	}
 }
 
 func server(w http.ResponseWriter, r *http.Request, admit admitHandler) {
 	var err error
+	start := time.Now()
+	outcome := outcomeDecodeError
+	defer func() {
+		observeAdmission(r.URL.Path, outcome, start)
+	}()
 	if r.Body == nil {
 		err = fmt.Errorf("request body is nil")
 		klog.ErrorS(err, "request body is nil")
@@ -61,9 +190,14 @@ func server(w http.ResponseWriter, r *http.Request, admit admitHandler) {
 	}
 
 	var body []byte
-	body, err = io.ReadAll(r.Body)
+	body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
 	if err != nil {
 		klog.ErrorS(err, "read request body failed")
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -88,9 +222,41 @@ func server(w http.ResponseWriter, r *http.Request, admit admitHandler) {
 		return
 	}
 
+	overloaded := !acquireInflight()
+	if overloaded {
+		if !admit.failOpen {
+			klog.Warningf("too many concurrent admission requests, reject %s", r.URL.Path)
+			outcome = outcomeRejectedOverloaded
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many concurrent admission requests", http.StatusTooManyRequests)
+			return
+		}
+		klog.Warningf("too many concurrent admission requests, allow %s without processing it", r.URL.Path)
+	} else {
+		defer releaseInflight()
+	}
+
 	var responseObj runtime.Object
 	switch *gvk {
-	// TODO v1beta1 admissionReview
+	case v1beta1.SchemeGroupVersion.WithKind("AdmissionReview"):
+		requestedAdmissionReview, ok := obj.(*v1beta1.AdmissionReview)
+		if !ok {
+			err = fmt.Errorf("expected v1beta1.AdmissionReview but got: %T", obj)
+			klog.ErrorS(err, "wrong object type")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		responseAdmissionReview := &v1beta1.AdmissionReview{}
+		responseAdmissionReview.SetGroupVersionKind(*gvk)
+		if overloaded {
+			responseAdmissionReview.Response = convertAdmissionResponseToV1beta1(toV1AdmissionResponseWithPatch(nil))
+			outcome = outcomeAllowedOverloaded
+		} else {
+			responseAdmissionReview.Response = admit.v1beta1(*requestedAdmissionReview)
+			outcome = admissionOutcome(responseAdmissionReview.Response.Allowed, responseAdmissionReview.Response.Patch)
+		}
+		responseAdmissionReview.Response.UID = requestedAdmissionReview.Request.UID
+		responseObj = responseAdmissionReview
 	case v1.SchemeGroupVersion.WithKind("AdmissionReview"):
 		requestedAdmissionReview, ok := obj.(*v1.AdmissionReview)
 		if !ok {
@@ -101,34 +267,73 @@ func server(w http.ResponseWriter, r *http.Request, admit admitHandler) {
 		}
 		responseAdmissionReview := &v1.AdmissionReview{}
 		responseAdmissionReview.SetGroupVersionKind(*gvk)
-		responseAdmissionReview.Response = admit.v1(*requestedAdmissionReview)
+		if overloaded {
+			responseAdmissionReview.Response = toV1AdmissionResponseWithPatch(nil)
+			outcome = outcomeAllowedOverloaded
+		} else {
+			responseAdmissionReview.Response = admit.v1(*requestedAdmissionReview)
+			outcome = admissionOutcome(responseAdmissionReview.Response.Allowed, responseAdmissionReview.Response.Patch)
+		}
 		responseAdmissionReview.Response.UID = requestedAdmissionReview.Request.UID
 		responseObj = responseAdmissionReview
-
-		klog.Infof("start writing response: %v", responseObj)
-
-		var respBytes []byte
-		respBytes, err = json.Marshal(responseObj)
-		if err != nil {
-			klog.ErrorS(err, "failed to marshal response object")
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		_, err = w.Write(respBytes)
-		if err != nil {
-			klog.ErrorS(err, "failed to write response")
-		}
 	default:
+		outcome = outcomeDecodeError
 		err = fmt.Errorf("unsupported group version kind: %v", gvk)
 		klog.ErrorS(err, "unsupported group version kind")
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	return
+
+	klog.Infof("start writing response: %v", responseObj)
+
+	var respBytes []byte
+	respBytes, err = json.Marshal(responseObj)
+	if err != nil {
+		klog.ErrorS(err, "failed to marshal response object")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(respBytes)
+	if err != nil {
+		klog.ErrorS(err, "failed to write response")
+	}
+}
+
+// acquireInflight returns whether the request can be served now without exceeding --max-concurrent-requests.
+// It doesn't wait, as waiting requests would pile up past the timeoutSeconds of the webhook anyway.
+func acquireInflight() bool {
+	if inflight == nil {
+		return true
+	}
+	select {
+	case inflight <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func releaseInflight() {
+	if inflight != nil {
+		<-inflight
+	}
 }
 
-func startServer(ctx context.Context, tlsConfig *tls.Config, cw *CertWatcher, admitter *Admitter) error {
+func admissionOutcome(allowed bool, patch []byte) string {
+	switch {
+	case !allowed:
+		return outcomeDenied
+	case len(patch) > 0:
+		return outcomeAllowedWithPatch
+	default:
+		return outcomeAllowedNoOp
+	}
+}
+
+// startServer serves the webhooks until stopCtx is done. Then it keeps serving for --shutdown-delay while not ready,
+// and shuts the server down, waiting up to --shutdown-timeout for in-flight requests to finish.
+func startServer(ctx, stopCtx context.Context, tlsConfig *tls.Config, cw *CertWatcher, admitter *Admitter) error {
 	go func() {
 		klog.Info("Starting certificate watcher")
 		if err := cw.Start(ctx); err != nil {
@@ -137,10 +342,22 @@ func startServer(ctx context.Context, tlsConfig *tls.Config, cw *CertWatcher, ad
 	}()
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/pods", admitter.serverPVCRequest)
+	mux.HandleFunc("/pods", requireClientCert(admitter.serverPVCRequest))
+	mux.HandleFunc("/initializers", requireClientCert(serveInitializerRequest))
+	if enableDebugExplain {
+		mux.HandleFunc("/debug/explain", requireClientCert(admitter.serveExplainRequest))
+	}
 	srv := &http.Server{
-		Handler:   mux,
-		TLSConfig: tlsConfig,
+		Handler:           mux,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: readTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
+	}
+	if maxConcurrentRequests > 0 {
+		inflight = make(chan struct{}, maxConcurrentRequests)
 	}
 
 	// listener is always closed by srv.Serve
@@ -148,28 +365,234 @@ func startServer(ctx context.Context, tlsConfig *tls.Config, cw *CertWatcher, ad
 	if err != nil {
 		return err
 	}
-	return srv.Serve(listener)
+	return serve(stopCtx, srv, listener)
+}
+
+// serve serves srv on listener until stopCtx is done, then shuts it down gracefully, see startServer.
+func serve(stopCtx context.Context, srv *http.Server, listener net.Listener) error {
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-stopCtx.Done()
+		klog.Infof("Shutting down, keep serving for %s until endpoints are updated", shutdownDelay)
+		shuttingDown.Store(true)
+		time.Sleep(shutdownDelay)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			klog.ErrorS(err, "failed to wait for in-flight requests to finish")
+			return
+		}
+		klog.Info("Server shut down")
+	}()
+
+	err := srv.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		<-shutdownDone
+		return nil
+	}
+	return err
 }
 
 func main(cmd *cobra.Command, args []string) {
-	// Create new cert watcher
 	ctx, cancel := context.WithCancel(cmd.Context())
 	defer cancel()
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		klog.Fatalf("failed to get kubeconfig: %v", err)
+	}
+
+	var certs *selfManagedCerts
+	if selfManagedCertsFlag {
+		certs, err = newSelfManagedCerts(cfg, serviceNamespace, certSecretName, serviceName, webhookConfigName, certDir)
+		if err != nil {
+			klog.Fatalf("failed to initialize self-managed certificates: %v", err)
+		}
+		if err = certs.Bootstrap(ctx); err != nil {
+			klog.Fatalf("failed to bootstrap self-managed certificates: %v", err)
+		}
+		certFile, keyFile = certs.certFile(), certs.keyFile()
+	} else if certFile == "" || keyFile == "" {
+		klog.Fatal("--tls-cert-file and --tls-private-key-file are required unless --self-managed-certs is set")
+	}
+
+	// Create new cert watcher
 	cw, err := NewCertWatcher(certFile, keyFile)
 	if err != nil {
 		klog.Fatalf("failed to initialize new cert watcher: %v", err)
 	}
-	tslConfig := &tls.Config{
-		GetCertificate: cw.GetCertificate,
+	var caw *ClientCAWatcher
+	if clientCAFile != "" {
+		caw, err = NewClientCAWatcher(clientCAFile)
+		if err != nil {
+			klog.Fatalf("failed to initialize client CA watcher: %v", err)
+		}
+		go func() {
+			klog.Info("Starting client CA watcher")
+			if err := caw.Start(ctx); err != nil {
+				klog.ErrorS(err, "failed to start client CA watcher")
+			}
+		}()
+	}
+	tslConfig, err := newTLSConfig(cw, caw, tlsMinVersion, tlsCipherSuites)
+	if err != nil {
+		klog.Fatalf("invalid TLS settings: %v", err)
+	}
+	if certs != nil {
+		certs.certWatcher = cw
+		go certs.Start(ctx)
 	}
 
-	admitter, err := NewAdmitter()
+	admitter, err := NewAdmitter(cfg)
 	if err != nil {
 		klog.Fatalf("failed to initialize new admitter: %v", err)
 	}
+	switch policy := MissingPVCPolicy(missingPVCPolicy); policy {
+	case MissingPVCPolicyDeny, MissingPVCPolicySkip:
+		admitter.missingPVCPolicy = policy
+	default:
+		klog.Fatalf("unsupported --missing-pvc-policy %q", missingPVCPolicy)
+	}
+	switch policy := NamespacePolicy(namespacePolicy); policy {
+	case NamespacePolicyOptOut, NamespacePolicyOptIn:
+		admitter.namespacePolicy = policy
+	default:
+		klog.Fatalf("unsupported --namespace-policy %q", namespacePolicy)
+	}
+
+	go func() {
+		klog.Info("Starting admitter cache")
+		if err := admitter.Start(ctx); err != nil {
+			klog.ErrorS(err, "failed to start admitter cache")
+		}
+	}()
 
-	err = startServer(ctx, tslConfig, cw, admitter)
+	if healthPort > 0 {
+		checks, err := readinessChecks(cfg, cw, admitter)
+		if err != nil {
+			klog.Fatalf("failed to initialize readiness checks: %v", err)
+		}
+		go func() {
+			klog.Infof("Starting health server on port %d", healthPort)
+			if err := startHealthServer(ctx, checks); err != nil {
+				klog.ErrorS(err, "failed to start health server")
+			}
+		}()
+	}
+
+	if enableStatusController {
+		if err = startStatusController(ctx, cfg); err != nil {
+			klog.Fatalf("failed to start initializer status controller: %v", err)
+		}
+	}
+
+	stopCtx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	err = startServer(ctx, stopCtx, tslConfig, cw, admitter)
 	if err != nil {
 		klog.Fatalf("failed to start server: %v", err)
 	}
 }
+
+// Leader election timings of the status controller, the defaults of Kubernetes controllers.
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// startStatusController runs the status controller in the background. With --leader-elect, it only runs while the
+// replica holds the --leader-election-id Lease, and the replica contends for the Lease again after losing it.
+func startStatusController(ctx context.Context, cfg *rest.Config) error {
+	if !leaderElect {
+		go func() {
+			if err := runStatusController(ctx, cfg); err != nil {
+				klog.ErrorS(err, "initializer status controller stopped")
+			}
+		}()
+		return nil
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	namespace := leaderElectionNS
+	if namespace == "" {
+		namespace = defaultNamespace()
+	}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: leaderElectionID},
+			Client:     kubeClient.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: hostname + "_" + string(uuid.NewUUID())},
+		},
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Name:            leaderElectionID,
+		Callbacks: leaderelection.LeaderCallbacks{
+			// ctx is done once the lease is lost
+			OnStartedLeading: func(ctx context.Context) {
+				klog.Infof("Acquired lease %s/%s", namespace, leaderElectionID)
+				if err := runStatusController(ctx, cfg); err != nil {
+					klog.ErrorS(err, "initializer status controller stopped")
+				}
+			},
+			OnStoppedLeading: func() {
+				klog.Infof("Released lease %s/%s", namespace, leaderElectionID)
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	go wait.UntilWithContext(ctx, elector.Run, retryPeriod)
+	return nil
+}
+
+// runStatusController runs the status controller along with its informers until ctx is done.
+func runStatusController(ctx context.Context, cfg *rest.Config) error {
+	clientset, err := versioned.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	metadataClient, err := metadata.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	informerFactory := informers.NewSharedInformerFactory(clientset, 10*time.Minute)
+	// only the annotations of the pods are needed
+	metadataInformerFactory := metadatainformer.NewSharedInformerFactory(metadataClient, 10*time.Minute)
+	pods := metadataInformerFactory.ForResource(corev1.SchemeGroupVersion.WithResource("pods")).Informer()
+	statusController, err := controller.NewStatusController(clientset, informerFactory, pods, injectedInitializers)
+	if err != nil {
+		return err
+	}
+	informerFactory.Start(ctx.Done())
+	metadataInformerFactory.Start(ctx.Done())
+	defer informerFactory.Shutdown()
+	defer metadataInformerFactory.Shutdown()
+	return statusController.Run(ctx, 1)
+}
+
+// defaultNamespace returns the namespace the webhook runs in, from the POD_NAMESPACE environment variable
+// or the service account, "default" if neither is available.
+func defaultNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	if data, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+		if ns := strings.TrimSpace(string(data)); ns != "" {
+			return ns
+		}
+	}
+	return metav1.NamespaceDefault
+}
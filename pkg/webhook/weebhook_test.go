@@ -0,0 +1,149 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+func TestServerOverloaded(t *testing.T) {
+	inflight = make(chan struct{}, 1)
+	inflight <- struct{}{}
+	defer func() { inflight = nil }()
+
+	review := admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{UID: "uid"}}
+	review.SetGroupVersionKind(admissionv1.SchemeGroupVersion.WithKind("AdmissionReview"))
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admit := func(admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+		t.Error("expected the request not to be processed")
+		return nil
+	}
+
+	for _, tc := range []struct {
+		name     string
+		failOpen bool
+		status   int
+	}{
+		{name: "fail open", failOpen: true, status: http.StatusOK},
+		{name: "fail closed", failOpen: false, status: http.StatusTooManyRequests},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := newDelegateToV1AdmitHandler(admit)
+			handler.failOpen = tc.failOpen
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			server(w, r, handler)
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, w.Code, w.Body)
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			resp := &admissionv1.AdmissionReview{}
+			if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+				t.Fatal(err)
+			}
+			if !resp.Response.Allowed || resp.Response.UID != "uid" {
+				t.Errorf("expected the request to be allowed, got %+v", resp.Response)
+			}
+		})
+	}
+}
+
+func TestServeGracefulShutdown(t *testing.T) {
+	defer func(delay, timeout time.Duration) { shutdownDelay, shutdownTimeout = delay, timeout }(shutdownDelay, shutdownTimeout)
+	shutdownDelay, shutdownTimeout = 200*time.Millisecond, 10*time.Second
+	defer shuttingDown.Store(false)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+	mux.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) {})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	stopCtx, stop := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- serve(stopCtx, &http.Server{Handler: mux}, listener) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	inflight := make(chan result)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			inflight <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		inflight <- result{body: string(body), err: err}
+	}()
+	<-started
+	stop()
+
+	// not ready, but still serving during the delay
+	deadline := time.Now().Add(5 * time.Second)
+	for !shuttingDown.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the shutdown to start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	w := httptest.NewRecorder()
+	readyzHandler([]healthCheck{shutdownCheck})(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected readyz to fail with %d during the delay, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get("http://" + addr + "/fast")
+	if err != nil {
+		t.Fatalf("expected new requests to be served during the delay: %v", err)
+	}
+	resp.Body.Close()
+
+	// then the listener is closed, and the in-flight request drained
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("expected the listener to be closed after the delay")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err = <-served:
+		t.Fatalf("expected the server to wait for the in-flight request, got %v", err)
+	default:
+	}
+	close(release)
+	if r := <-inflight; r.err != nil || r.body != "done" {
+		t.Errorf("expected the in-flight request to complete, got %q, %v", r.body, r.err)
+	}
+	if err = <-served; err != nil {
+		t.Errorf("expected a graceful shutdown, got %v", err)
+	}
+}